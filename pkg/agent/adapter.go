@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// adapter translates a broadcasted request into the requests replayed
+// against the target.
+type adapter interface {
+	requests(request dto.Request) ([]dto.Request, error)
+}
+
+// successAdapter is implemented by the adapters considering other status
+// codes as a success, in addition to the retry policy's success codes.
+type successAdapter interface {
+	success(request dto.Request, code int) bool
+}
+
+// newAdapter returns the adapter selected by the prefix of the scheme of the
+// endpoint (ie. "varnish+http"), and the endpoint without that prefix.
+func newAdapter(endpoint *url.URL) (adapter, *url.URL, error) {
+	if endpoint == nil {
+		return httpAdapter{}, nil, nil
+	}
+
+	switch endpoint.Scheme {
+	case "varnishadm":
+		return varnishAdapter{}, endpoint, nil
+	case "exec":
+		return rawAdapter{}, endpoint, nil
+	}
+
+	i := strings.Index(endpoint.Scheme, "+")
+	if i < 0 {
+		return httpAdapter{}, endpoint, nil
+	}
+
+	stripped := *endpoint
+	stripped.Scheme = endpoint.Scheme[i+1:]
+
+	switch name := endpoint.Scheme[:i]; name {
+	case "varnish":
+		return varnishAdapter{}, &stripped, nil
+	case "nginx":
+		return nginxAdapter{}, &stripped, nil
+	case "squid":
+		return squidAdapter{}, &stripped, nil
+	default:
+		return nil, nil, fmt.Errorf(`unsupported adapter "%s"`, name)
+	}
+}
+
+// httpAdapter replays the requests as is, and purges the URLs of the
+// invalidations.
+type httpAdapter struct{}
+
+func (httpAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	if request.Invalidation == nil {
+		return []dto.Request{request}, nil
+	}
+
+	if len(request.Invalidation.Bans) > 0 || len(request.Invalidation.Tags) > 0 {
+		return nil, errors.New("bans and tags are not supported by the target")
+	}
+
+	return purgeRequests(request, request.Invalidation.URLs)
+}
+
+// purgeRequests returns a PURGE request for each URL.
+func purgeRequests(request dto.Request, urls []string) ([]dto.Request, error) {
+	requests := make([]dto.Request, 0, len(urls))
+
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid URL")
+		}
+
+		requests = append(requests, derive(request, "PURGE", u.Host, pathWithQuery(u), http.Header{}))
+	}
+
+	return requests, nil
+}
+
+// pathWithQuery returns the path of the URL followed by its query string.
+func pathWithQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	return u.Path + "?" + u.RawQuery
+}
+
+// derive returns a new request sharing the ID and trace of the broadcasted
+// request.
+func derive(request dto.Request, method string, host string, path string, header http.Header) dto.Request {
+	if path == "" {
+		path = "/"
+	}
+
+	return dto.Request{
+		ID:     request.ID,
+		Method: method,
+		Host:   host,
+		Path:   path,
+		Header: header,
+		Trace:  request.Trace,
+	}
+}
@@ -2,29 +2,47 @@ package agent
 
 import (
 	"context"
-	"fmt"
-	"net/url"
 	"sync"
 
-	"github.com/cenkalti/backoff"
 	"github.com/pkg/errors"
 	"github.com/r3labs/sse"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/redact"
 	"github.com/jderusse/http-broadcast/pkg/sync/atomic"
+	"github.com/jderusse/http-broadcast/pkg/tenant"
+	"github.com/jderusse/http-broadcast/pkg/token"
 )
 
 // Agent listen for request and dispatch it to a target
 type Agent struct {
-	events chan *sse.Event
+	events    chan hubEvent
+	adapter   adapter
+	target    target
+	publisher *hub.Publisher
+	redactor  *redact.Redactor
+
+	subscribeToken token.Provider
 
 	options *config.Options
 
-	inShutdown atomic.Bool
-	mu         sync.Mutex
-	doneChan   chan struct{}
-	onShutdown []func()
+	trackers map[string]*tracker
+	seen     *seenSet
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	inShutdown  atomic.Bool
+	mu          sync.Mutex
+	doneChan    chan struct{}
+	stoppedChan chan struct{}
+	onShutdown  []func()
+}
+
+type hubEvent struct {
+	hub   string
+	event *sse.Event
 }
 
 // ErrServerClosed is returned by the Agent's ListenAndServe methods after a call to Shutdown or Close.
@@ -59,60 +77,120 @@ func (a *Agent) shuttingDown() bool {
 	return a.inShutdown.Load()
 }
 
+// topic returns the topic the agent subscribes to: the topic of its tenant
+// when the agent belongs to a tenant.
+func (a *Agent) topic() string {
+	if a.options.Agent.Tenant != "" {
+		return tenant.Topic(a.options.Hub.Topic, a.options.Agent.Tenant)
+	}
+
+	return a.options.Hub.Topic
+}
+
+// statusTopic returns the topic the agent publishes its status into: the
+// status topic of its tenant when the agent belongs to a tenant.
+func (a *Agent) statusTopic() string {
+	if a.options.Agent.Tenant != "" {
+		return tenant.Topic(a.options.Hub.StatusTopic, a.options.Agent.Tenant)
+	}
+
+	return a.options.Hub.StatusTopic
+}
+
 func (a *Agent) listen() error {
 	log.Debug("agent: starting")
 
-	client := sse.NewClient(a.hubURL())
-	if a.options.Hub.SubscribeToken != "" {
-		client.Headers["Authorization"] = fmt.Sprintf("Bearer %s", a.options.Hub.SubscribeToken)
+	checkpoint, err := a.readCheckpoint()
+	if err != nil {
+		log.Warn(errors.Wrap(err, "agent: read checkpoint"))
 	}
 
-	client.OnDisconnect(func(c *sse.Client) {
-		log.WithFields(log.Fields{"hub": a.hubURL()}).Warn("agent: disconnected")
-	})
-
 	ctx, cancel := context.WithCancel(context.Background())
 
 	a.RegisterOnShutdown(func() { cancel() })
 
-	retry := backoff.NewExponentialBackOff()
-	retry.MaxInterval = defaultMaxInterval
-	retry.MaxElapsedTime = 0
-	client.ReconnectStrategy = backoff.WithContext(retry, ctx)
+	for _, endpoint := range a.options.Hub.Endpoints {
+		subscription := hub.Subscription{
+			Endpoint:    endpoint,
+			Topic:       a.topic(),
+			Token:       a.subscribeToken,
+			LastEventID: checkpoint[endpoint.String()],
+		}
+
+		if subscription.LastEventID != "" {
+			log.WithFields(log.Fields{"hub": subscription.URL(), "lastEventID": subscription.LastEventID}).Info("agent: resuming from checkpoint")
+		}
+
+		a.trackers[endpoint.String()] = &tracker{}
 
-	if err := client.SubscribeChanWithContext(ctx, "", a.events); err != nil {
-		return errors.Wrap(err, "subscribe to stream")
+		go a.subscribe(ctx, endpoint.String(), subscription)
 	}
 
-	log.WithFields(log.Fields{"hub": a.hubURL()}).Info("agent: listening")
+	if a.publisher != nil && a.options.Agent.HeartbeatInterval > 0 {
+		go a.heartbeat(ctx)
+	}
 
 	return nil
 }
 
+// subscribe waits for the subscription to the hub, then forwards its events.
+// Each hub is subscribed independently, so that an unreachable hub does not
+// prevent the agent from listening to the others.
+func (a *Agent) subscribe(ctx context.Context, hubName string, subscription hub.Subscription) {
+	events := make(chan *sse.Event)
+	if err := hub.Subscribe(ctx, subscription, events); err != nil {
+		if ctx.Err() == nil {
+			log.WithFields(log.Fields{"hub": subscription.URL()}).Error(errors.Wrap(err, "agent: subscribe"))
+		}
+
+		return
+	}
+
+	log.WithFields(log.Fields{"hub": subscription.URL()}).Info("agent: listening")
+
+	a.forward(ctx, hubName, events)
+}
+
+// forward tags the events received from a hub with the hub's name.
+func (a *Agent) forward(ctx context.Context, hubName string, events chan *sse.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			select {
+			case <-ctx.Done():
+				return
+			case a.events <- hubEvent{hub: hubName, event: event}:
+			}
+		}
+	}
+}
+
 func (a *Agent) serve() error {
 	for {
 		select {
 		case <-a.getDoneChan():
 			return ErrServerClosed
-		case event := <-a.events:
+		case he := <-a.events:
+			event := he.event
 			if event != nil && len(event.Data) > 0 {
-				go a.replay(string(event.ID), event.Data)
+				t := a.trackers[he.hub]
+				e := t.start(string(event.ID))
+
+				go func() {
+					defer t.finish(e)
+					a.replay(string(event.ID), event.Data)
+				}()
 			}
 		}
 	}
 }
 
-func (a *Agent) hubURL() string {
-	hubURL, _ := url.Parse(a.options.Hub.Endpoint.String())
-	q := hubURL.Query()
-	q.Set("topic", a.options.Hub.Topic)
-	hubURL.RawQuery = q.Encode()
-
-	return hubURL.String()
-}
-
 // Shutdown gracefully shuts down the agent without interrupting any
-// active event. Shutdown works by closing stream.
+// active event. Shutdown works by closing stream, then waiting for the
+// requests being replayed to finish, up to the drain timeout. Finally the
+// ID of the last processed event is stored in the checkpoint file.
 //
 // When Shutdown is called, ListenAndServe immediately return
 // ErrServerClosed. Make sure the program doesn't exit and waits
@@ -122,9 +200,12 @@ func (a *Agent) hubURL() string {
 // future calls to methods such as Serve will return ErrServerClosed.
 func (a *Agent) Shutdown() error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
 
 	if a.shuttingDown() {
+		stopped := a.getStoppedChanLocked()
+		a.mu.Unlock()
+		<-stopped
+
 		return nil
 	}
 
@@ -138,11 +219,56 @@ func (a *Agent) Shutdown() error {
 		go f()
 	}
 
+	stopped := a.getStoppedChanLocked()
+	a.mu.Unlock()
+
+	defer close(stopped)
+
+	checkpoint := a.drain()
+	a.cancel()
+
+	if err := a.writeCheckpoint(checkpoint); err != nil {
+		return errors.Wrap(err, "agent: write checkpoint")
+	}
+
 	log.Debug("agent: stopped")
 
 	return nil
 }
 
+// drain waits for the pending replays to finish and returns the ID of the
+// last processed event of each hub.
+func (a *Agent) drain() map[string]string {
+	ctx := context.Background()
+
+	if a.options.Agent.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.options.Agent.DrainTimeout)
+
+		defer cancel()
+	}
+
+	log.Debug("agent: draining")
+
+	for _, t := range a.trackers {
+		if err := t.wait(ctx); err != nil {
+			log.Warn("agent: drain timeout exceeded, aborting pending requests")
+
+			break
+		}
+	}
+
+	checkpoint := map[string]string{}
+
+	for hubName, t := range a.trackers {
+		if lastEventID := t.lastEventID(); lastEventID != "" {
+			checkpoint[hubName] = lastEventID
+		}
+	}
+
+	return checkpoint
+}
+
 func (a *Agent) closeDoneChanLocked() {
 	ch := a.getDoneChanLocked()
 	select {
@@ -170,10 +296,65 @@ func (a *Agent) getDoneChanLocked() chan struct{} {
 	return a.doneChan
 }
 
+func (a *Agent) getStoppedChanLocked() chan struct{} {
+	if a.stoppedChan == nil {
+		a.stoppedChan = make(chan struct{})
+	}
+
+	return a.stoppedChan
+}
+
 // NewAgent allocates and returns a new Agent.
-func NewAgent(options *config.Options) *Agent {
-	return &Agent{
-		events:  make(chan *sse.Event),
-		options: options,
+func NewAgent(options *config.Options) (*Agent, error) {
+	adapter, endpoint, err := newAdapter(options.Agent.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "agent: create adapter")
+	}
+
+	if options.Agent.InvalidationTemplates != "" {
+		if adapter, err = newTemplateAdapter(options.Agent.InvalidationTemplates, adapter); err != nil {
+			return nil, errors.Wrap(err, "agent: load invalidation templates")
+		}
+	}
+
+	if options.Agent.Script != "" {
+		if adapter, err = newScriptAdapter(options.Agent.Script, options.Agent, adapter); err != nil {
+			return nil, errors.Wrap(err, "agent: load script")
+		}
+	}
+
+	target, err := newTarget(endpoint, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := &Agent{
+		events:   make(chan hubEvent),
+		trackers: map[string]*tracker{},
+		seen:     newSeenSet(defaultSeenSetSize),
+		adapter:  adapter,
+		target:   target,
+		redactor: redact.New(options.Log),
+		options:  options,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	if a.subscribeToken, err = token.Subscriber(options, a.topic()); err != nil {
+		return nil, errors.Wrap(err, "agent: create subscribe token")
 	}
+
+	if options.Hub.StatusTopic != "" {
+		publishToken, err := token.Publisher(options, a.statusTopic())
+		if err != nil {
+			return nil, errors.Wrap(err, "agent: create publish token")
+		}
+
+		a.publisher = hub.NewPublisher(options.Hub)
+		a.publisher.SetTokenProvider(publishToken)
+	}
+
+	return a, nil
 }
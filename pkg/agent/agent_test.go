@@ -1,9 +1,13 @@
 package agent
 
 import (
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -38,7 +42,46 @@ func cleanup() {
 }
 
 func TestNewAgent(t *testing.T) {
-	NewAgent(&config.Options{})
+	a, err := NewAgent(&config.Options{})
+	assert.NotNil(t, a)
+	assert.Nil(t, err)
+}
+
+func TestNewAgentInvalidClient(t *testing.T) {
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Client: config.ClientOptions{
+				TLS: config.TLSClientOptions{
+					CAFile: "/does/not/exists",
+				},
+			},
+		},
+	})
+	assert.Nil(t, a)
+	assert.EqualError(t, err, "agent: create HTTP client: read CA file: open /does/not/exists: no such file or directory")
+}
+
+func TestNewAgentInvalidJWTKey(t *testing.T) {
+	_, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{Endpoint: parseSafeURL("http://localhost")},
+		Hub: config.HubOptions{
+			JWT: config.JWTOptions{Algorithm: config.JWTAlgorithmES256, Key: "invalid"},
+		},
+	})
+	assert.EqualError(t, err, "agent: create subscribe token: invalid key: Key must be a PEM encoded PKCS1 or PKCS8 key")
+}
+
+func TestAgentTopic(t *testing.T) {
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{Endpoint: parseSafeURL("http://localhost")},
+		Hub:   config.HubOptions{Topic: "https://example.com/purge", StatusTopic: "https://example.com/status"},
+	})
+	assert.Equal(t, "https://example.com/purge", s.topic())
+	assert.Equal(t, "https://example.com/status", s.statusTopic())
+
+	s.options.Agent.Tenant = "brand-a"
+	assert.Equal(t, "https://example.com/purge/brand-a", s.topic())
+	assert.Equal(t, "https://example.com/status/brand-a", s.statusTopic())
 }
 
 func TestServe(t *testing.T) {
@@ -51,12 +94,12 @@ func TestServe(t *testing.T) {
 	}))
 	defer targetServer.Close()
 
-	s := NewAgent(&config.Options{
+	s, _ := NewAgent(&config.Options{
 		Agent: config.AgentOptions{
 			Endpoint: parseSafeURL(targetServer.URL),
 		},
 		Hub: config.HubOptions{
-			Endpoint: parseSafeURL(server.URL + "/events?stream=foo"),
+			Endpoints: []*url.URL{parseSafeURL(server.URL + "/events?stream=foo")},
 		},
 	})
 
@@ -83,12 +126,12 @@ func TestShutdown(t *testing.T) {
 	}))
 	defer targetServer.Close()
 
-	s := NewAgent(&config.Options{
+	s, _ := NewAgent(&config.Options{
 		Agent: config.AgentOptions{
 			Endpoint: parseSafeURL(targetServer.URL),
 		},
 		Hub: config.HubOptions{
-			Endpoint: parseSafeURL(server.URL + "/events?stream=foo"),
+			Endpoints: []*url.URL{parseSafeURL(server.URL + "/events?stream=foo")},
 		},
 	})
 
@@ -109,3 +152,206 @@ func parseSafeURL(urlString string) *url.URL {
 	u, _ := url.Parse(urlString)
 	return u
 }
+
+// newTempFile writes the content in a file removed at the end of the test.
+func newTempFile(t *testing.T, name string, perm os.FileMode, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), perm))
+
+	return file
+}
+
+func TestShutdownDrain(t *testing.T) {
+	newServer()
+	defer cleanup()
+
+	var played int32
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		atomic.AddInt32(&played, 1)
+	}))
+	defer targetServer.Close()
+
+	dir := t.TempDir()
+
+	checkpoint := filepath.Join(dir, "checkpoint")
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint:       parseSafeURL(targetServer.URL),
+			DrainTimeout:   time.Second,
+			CheckpointFile: checkpoint,
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(server.URL + "/events?stream=foo")},
+		},
+	})
+	err := s.listen()
+	require.NoError(t, err)
+
+	go s.serve()
+
+	srv.Publish("foo", &sse.Event{ID: []byte("123"), Data: []byte("{}")})
+	time.Sleep(20 * time.Millisecond)
+
+	s.Shutdown()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&played))
+
+	b, err := ioutil.ReadFile(checkpoint)
+	require.NoError(t, err)
+	assert.NotEmpty(t, string(b))
+
+	s, _ = NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			CheckpointFile: checkpoint,
+		},
+	})
+	lastEventIDs, err := s.readCheckpoint()
+	require.NoError(t, err)
+	assert.Len(t, lastEventIDs, 1)
+	assert.NotEmpty(t, lastEventIDs[server.URL+"/events?stream=foo"])
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	newServer()
+	defer cleanup()
+
+	var played int32
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&played, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer targetServer.Close()
+
+	dir := t.TempDir()
+
+	checkpoint := filepath.Join(dir, "checkpoint")
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint:       parseSafeURL(targetServer.URL),
+			DrainTimeout:   50 * time.Millisecond,
+			CheckpointFile: checkpoint,
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(server.URL + "/events?stream=foo")},
+		},
+	})
+	err := s.listen()
+	require.NoError(t, err)
+
+	go s.serve()
+
+	srv.Publish("foo", &sse.Event{ID: []byte("123"), Data: []byte("{}")})
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	s.Shutdown()
+	assert.True(t, time.Since(start) < time.Second)
+	assert.True(t, atomic.LoadInt32(&played) > 0)
+
+	_, err = os.Stat(checkpoint)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServeMultipleHubs(t *testing.T) {
+	var servers []*httptest.Server
+	var streams []*sse.Server
+	for i := 0; i < 2; i++ {
+		srv := sse.New()
+		defer srv.Close()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/events", srv.HTTPHandler)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		srv.CreateStream("foo")
+		servers = append(servers, server)
+		streams = append(streams, srv)
+	}
+
+	var played int32
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&played, 1)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{
+				parseSafeURL(servers[0].URL + "/events?stream=foo"),
+				parseSafeURL(servers[1].URL + "/events?stream=foo"),
+			},
+		},
+	})
+	err := s.listen()
+	require.NoError(t, err)
+
+	go s.serve()
+	defer s.Shutdown()
+
+	streams[0].Publish("foo", &sse.Event{Data: []byte(`{"ID":"1"}`)})
+	streams[1].Publish("foo", &sse.Event{Data: []byte(`{"ID":"1"}`)})
+	streams[1].Publish("foo", &sse.Event{Data: []byte(`{"ID":"2"}`)})
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&played))
+}
+
+func TestServeWithUnreachableHub(t *testing.T) {
+	// reserve a port nobody listens on
+	deadLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadLn.Close()
+
+	srv := sse.New()
+	defer srv.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", srv.HTTPHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	srv.CreateStream("foo")
+
+	var played int32
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&played, 1)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{
+				parseSafeURL("http://" + deadLn.Addr().String() + "/events?stream=foo"),
+				parseSafeURL(server.URL + "/events?stream=foo"),
+			},
+		},
+	})
+
+	listened := make(chan error)
+	go func() { listened <- s.listen() }()
+
+	select {
+	case err := <-listened:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent blocked by the unreachable hub")
+	}
+
+	go s.serve()
+	defer s.Shutdown()
+
+	srv.Publish("foo", &sse.Event{Data: []byte(`{"ID":"1"}`)})
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&played) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
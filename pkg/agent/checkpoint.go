@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// readCheckpoint returns the ID of the last event processed by a previous
+// run of the agent, indexed by hub.
+func (a *Agent) readCheckpoint() (map[string]string, error) {
+	checkpoint := map[string]string{}
+
+	if a.options.Agent.CheckpointFile == "" {
+		return checkpoint, nil
+	}
+
+	b, err := ioutil.ReadFile(a.options.Agent.CheckpointFile)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+
+	if err != nil {
+		return checkpoint, err
+	}
+
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return map[string]string{}, err
+	}
+
+	return checkpoint, nil
+}
+
+// writeCheckpoint atomically stores the ID of the last processed event of
+// each hub.
+func (a *Agent) writeCheckpoint(checkpoint map[string]string) error {
+	if a.options.Agent.CheckpointFile == "" || len(checkpoint) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(a.options.Agent.CheckpointFile), ".checkpoint")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), a.options.Agent.CheckpointFile)
+}
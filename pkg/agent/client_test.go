@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+func TestClientTimeout(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer targetServer.Close()
+
+	client, err := newHTTPClient(config.ClientOptions{Timeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = client.Get(targetServer.URL)
+	assert.Error(t, err)
+}
+
+func TestClientTLS(t *testing.T) {
+	targetServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer targetServer.Close()
+
+	client, err := newHTTPClient(config.ClientOptions{})
+	require.NoError(t, err)
+
+	_, err = client.Get(targetServer.URL)
+	assert.Error(t, err) // self signed certificate
+
+	client, err = newHTTPClient(config.ClientOptions{TLS: config.TLSClientOptions{InsecureSkipVerify: true}})
+	require.NoError(t, err)
+
+	resp, err := client.Get(targetServer.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: targetServer.Certificate().Raw}), 0600)
+
+	client, err = newHTTPClient(config.ClientOptions{TLS: config.TLSClientOptions{CAFile: caFile}})
+	require.NoError(t, err)
+
+	resp, err = client.Get(targetServer.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestClientInvalidCA(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, []byte("foo"), 0600)
+
+	_, err := newHTTPClient(config.ClientOptions{TLS: config.TLSClientOptions{CAFile: caFile}})
+	assert.EqualError(t, err, `no certificate found in CA file "`+caFile+`"`)
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	var host string
+	targetServer := &httptest.Server{
+		Listener: ln,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host = r.Host
+		})},
+	}
+	targetServer.Start()
+	defer targetServer.Close()
+
+	client, err := newHTTPClient(config.ClientOptions{UnixSocket: socket})
+	require.NoError(t, err)
+
+	resp, err := client.Get("http://example.com/foo")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "example.com", host)
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/headerpolicy"
+	"github.com/jderusse/http-broadcast/pkg/tracing"
+)
+
+// maxExecOutput is the maximum size of the output of the command reported in
+// errors
+const maxExecOutput = 512
+
+// rawAdapter passes the requests, and the invalidations, as is.
+type rawAdapter struct{}
+
+func (rawAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	return []dto.Request{request}, nil
+}
+
+// exitError is returned when the command exits with a non-zero code listed in
+// the retry codes. It is retried regardless of the RetryOnError policy.
+type exitError struct {
+	err error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) retryable() bool {
+	return true
+}
+
+// execTarget runs a command for each request. The request is written as JSON
+// on the standard input of the command, and its fields are passed in
+// environment variables.
+type execTarget struct {
+	command      string
+	args         []string
+	timeout      time.Duration
+	retryCodes   config.StatusCodes
+	headerPolicy *headerpolicy.Policy
+}
+
+func newExecTarget(endpoint *url.URL, args []string, timeout time.Duration, retryCodes config.StatusCodes, headerPolicy *headerpolicy.Policy) *execTarget {
+	command := endpoint.Path
+	if command == "" {
+		command = endpoint.Opaque
+	}
+
+	return &execTarget{
+		command:      command,
+		args:         args,
+		timeout:      timeout,
+		retryCodes:   retryCodes,
+		headerPolicy: headerPolicy,
+	}
+}
+
+func (t *execTarget) url(request dto.Request) string {
+	return "exec:" + t.command
+}
+
+func (t *execTarget) send(ctx context.Context, requestID string, request dto.Request) (int, error) {
+	request.Header = t.headerPolicy.Apply(request.Header)
+
+	stdin, err := json.Marshal(request)
+	if err != nil {
+		return 0, err
+	}
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, t.command, t.args...) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = defaultExecWaitDelay
+	cmd.Env = append(os.Environ(),
+		"HTTP_BROADCAST_MESSAGE_ID="+request.ID,
+		"HTTP_BROADCAST_METHOD="+request.Method,
+		"HTTP_BROADCAST_HOST="+request.Host,
+		"HTTP_BROADCAST_PATH="+request.Path,
+	)
+
+	for k, v := range tracing.Inject(ctx) {
+		cmd.Env = append(cmd.Env, strings.ToUpper(k)+"="+v)
+	}
+
+	err = cmd.Run()
+
+	log.WithFields(log.Fields{"requestID": requestID, "command": t.command, "output": output.String()}).Debug("Agent: command executed")
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, errors.Wrap(ctx.Err(), "exec")
+		}
+
+		out := strings.TrimSpace(output.String())
+		if len(out) > maxExecOutput {
+			out = out[len(out)-maxExecOutput:]
+		}
+
+		return 0, t.exitError(err, out)
+	}
+
+	return http.StatusOK, nil
+}
+
+// exitError classifies the failure of the command. Without retry codes, every
+// failure is retried like a network error. Otherwise, only the listed exit
+// codes are retried, and the others are permanent failures.
+func (t *execTarget) exitError(err error, output string) error {
+	wrapped := fmt.Errorf("exec: %s: %s", err, output)
+	if len(t.retryCodes) == 0 {
+		return wrapped
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok && t.retryCodes.Contains(exitErr.ExitCode()) {
+		return &exitError{wrapped}
+	}
+
+	return backoff.Permanent(wrapped)
+}
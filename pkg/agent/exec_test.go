@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/headerpolicy"
+)
+
+func TestReplayExec(t *testing.T) {
+	dir := t.TempDir()
+
+	output := filepath.Join(dir, "output")
+	script := newTempFile(t, "script.sh", 0700, `#!/bin/sh
+cat > `+output+`.json
+echo "$1 $HTTP_BROADCAST_MESSAGE_ID $HTTP_BROADCAST_METHOD $HTTP_BROADCAST_HOST $HTTP_BROADCAST_PATH" > `+output+`.env
+`)
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("exec:" + script),
+			ExecArgs: []string{"--all"},
+		},
+	})
+	require.NoError(t, err)
+
+	data, _ := dto.Marshal(*dto.NewInvalidationRequest(dto.Invalidation{Tags: []string{"product-42"}}), dto.FormatJSON)
+	a.replay("random", data)
+
+	env, err := ioutil.ReadFile(output + ".env")
+	require.NoError(t, err)
+	assert.Regexp(t, `^--all [0-9A-Z]{26} INVALIDATE  /\n$`, string(env))
+
+	b, err := ioutil.ReadFile(output + ".json")
+	require.NoError(t, err)
+
+	var request dto.Request
+	require.NoError(t, json.Unmarshal(b, &request))
+	assert.Equal(t, &dto.Invalidation{Tags: []string{"product-42"}}, request.Invalidation)
+}
+
+func TestExecTargetFailure(t *testing.T) {
+	target := newExecTarget(parseSafeURL("exec:"+newTempFile(t, "script.sh", 0700, "#!/bin/sh\necho 'cache not found' >&2\nexit 3\n")), nil, 0, nil, headerpolicy.New(config.HeaderPolicyOptions{}))
+	_, err := target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.EqualError(t, err, "exec: exit status 3: cache not found")
+
+	target = newExecTarget(parseSafeURL("exec:"+newTempFile(t, "script.sh", 0700, "#!/bin/sh\nsleep 5\n")), nil, 50*time.Millisecond, nil, headerpolicy.New(config.HeaderPolicyOptions{}))
+	_, err = target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.EqualError(t, err, "exec: context deadline exceeded")
+
+	target = newExecTarget(parseSafeURL("exec:"+newTempFile(t, "script.sh", 0700, "#!/bin/sh\nexit 0\n")), nil, 0, nil, headerpolicy.New(config.HeaderPolicyOptions{}))
+	code, err := target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+}
+
+func TestReplayExecRetry(t *testing.T) {
+	dir := t.TempDir()
+
+	counter := filepath.Join(dir, "counter")
+	script := newTempFile(t, "script.sh", 0700, `#!/bin/sh
+echo x >> `+counter+`
+[ $(wc -l < `+counter+`) -ge 2 ]
+`)
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("exec:" + script),
+			Retry: config.RetryOptions{
+				Delay:           time.Second,
+				InitialInterval: time.Millisecond,
+				MaxAttempts:     3,
+				RetryOnError:    true,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	code, err := a.play(a.ctx, "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+
+	b, _ := ioutil.ReadFile(counter)
+	assert.Equal(t, "x\nx\n", string(b))
+}
+
+func TestReplayExecRetryCodes(t *testing.T) {
+	dir := t.TempDir()
+
+	counter := filepath.Join(dir, "counter")
+	script := newTempFile(t, "script.sh", 0700, `#!/bin/sh
+echo x >> `+counter+`
+case $(wc -l < `+counter+`) in
+	1) exit 75;;
+	2) exit 3;;
+esac
+`)
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint:       parseSafeURL("exec:" + script),
+			ExecRetryCodes: config.StatusCodes{{Min: 75, Max: 75}},
+			Retry: config.RetryOptions{
+				Delay:           time.Second,
+				InitialInterval: time.Millisecond,
+				MaxAttempts:     5,
+				RetryOnError:    false,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = a.play(a.ctx, "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.EqualError(t, err, "exec: exit status 3: ")
+
+	b, _ := ioutil.ReadFile(counter)
+	assert.Equal(t, "x\nx\n", string(b))
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// nginxAdapter translates invalidations into the requests understood by the
+// ngx_cache_purge module: PURGE of URLs, and PURGE of wildcard URLs (ie.
+// "/products/*") for the bans matching a prefix. Other requests are replayed
+// as is.
+type nginxAdapter struct{}
+
+func (nginxAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	if request.Invalidation == nil {
+		return []dto.Request{request}, nil
+	}
+
+	if len(request.Invalidation.Tags) > 0 {
+		return nil, errors.New("tags are not supported by nginx")
+	}
+
+	urls := request.Invalidation.URLs
+
+	for _, ban := range request.Invalidation.Bans {
+		prefix, err := banPrefix(ban)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, prefix+"*")
+	}
+
+	return purgeRequests(request, urls)
+}
+
+// success considers the purge of an uncached URL as a success.
+func (nginxAdapter) success(request dto.Request, code int) bool {
+	return request.Method == "PURGE" && code == http.StatusNotFound
+}
+
+// banPrefix returns the prefix matched by a ban of the form "^/prefix" or
+// "^/prefix.*".
+func banPrefix(ban string) (string, error) {
+	if strings.HasPrefix(ban, "^") {
+		re, err := regexp.Compile(strings.TrimSuffix(ban[1:], ".*"))
+		if err == nil {
+			if prefix, complete := re.LiteralPrefix(); complete {
+				return prefix, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf(`only bans matching a prefix (ie. "^/products/") are supported, got "%s"`, ban)
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestNginxAdapter(t *testing.T) {
+	request := dto.Request{ID: "id", Method: "PURGE", Path: "/foo"}
+	requests, err := nginxAdapter{}.requests(request)
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{request}, requests)
+
+	requests, err = nginxAdapter{}.requests(dto.Request{ID: "id", Invalidation: &dto.Invalidation{
+		URLs: []string{"https://www.example.com/foo", "/bar/*"},
+		Bans: []string{"^/products/", "^/categories/.*"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{
+		{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "/foo", Header: http.Header{}},
+		{ID: "id", Method: "PURGE", Path: "/bar/*", Header: http.Header{}},
+		{ID: "id", Method: "PURGE", Path: "/products/*", Header: http.Header{}},
+		{ID: "id", Method: "PURGE", Path: "/categories/*", Header: http.Header{}},
+	}, requests)
+
+	_, err = nginxAdapter{}.requests(dto.Request{Invalidation: &dto.Invalidation{Bans: []string{`^/products/\d+`}}})
+	assert.EqualError(t, err, `only bans matching a prefix (ie. "^/products/") are supported, got "^/products/\d+"`)
+
+	_, err = nginxAdapter{}.requests(dto.Request{Invalidation: &dto.Invalidation{Tags: []string{"foo"}}})
+	assert.EqualError(t, err, "tags are not supported by nginx")
+}
+
+func TestReplayNginx(t *testing.T) {
+	var received []string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer targetServer.Close()
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("nginx+" + targetServer.URL),
+			Retry: config.RetryOptions{
+				MaxAttempts: 1,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	request := dto.Request{Method: "PURGE", Path: "/"}
+	code, err := a.play(a.ctx, "random", request)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.NoError(t, err)
+
+	request.Method = "GET"
+	_, err = a.play(a.ctx, "random", request)
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"PURGE /", "GET /"}, received)
+}
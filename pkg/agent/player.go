@@ -1,65 +1,203 @@
 package agent
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/jderusse/http-broadcast/pkg/config"
 	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/tracing"
 )
 
 func (a *Agent) replay(requestID string, data []byte) {
 	var request dto.Request
-
-	if err := json.Unmarshal(data, &request); err != nil {
+	if err := dto.Unmarshal(data, &request); err != nil {
 		log.Error(errors.Wrap(err, "parse Request"))
 		return
 	}
 
-	log.WithFields(log.Fields{"requestID": requestID, "request": request}).Debug("Agent: playing request")
+	if err := request.Decode(a.options.Agent.MaxBodySize); err != nil {
+		log.WithFields(log.Fields{"requestID": requestID, "messageID": request.ID}).Error(errors.Wrap(err, "decode Request"))
+		return
+	}
+
+	if request.ID != "" && !a.seen.add(request.ID) {
+		log.WithFields(log.Fields{"requestID": requestID, "messageID": request.ID}).Debug("Agent: request already played")
+
+		return
+	}
+
+	ctx, span := tracing.Tracer().Start(tracing.Extract(a.ctx, request.Trace), "replay",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("http_broadcast.message_id", request.ID),
+			attribute.String("http_broadcast.agent", a.options.Agent.ID),
+		),
+	)
 
-	targetURL, _ := url.Parse(a.options.Agent.Endpoint.String())
-	targetURL.Path = fmt.Sprintf("%s/%s", strings.TrimRight(a.options.Agent.Endpoint.Path, "/"), strings.TrimLeft(request.Path, "/"))
+	defer span.End()
 
-	req, _ := http.NewRequest(request.Method, targetURL.String(), bytes.NewBuffer(request.Body))
-	req.Header = request.Header
-	req.Host = request.Host
+	traceID := tracing.TraceID(ctx)
+
+	log.WithFields(log.Fields{"requestID": requestID, "traceID": traceID, "request": a.redactor.Request(request)}).Debug("Agent: playing request")
+
+	start := time.Now()
+
+	requests, err := a.adapter.requests(request)
+	if err != nil {
+		log.WithFields(log.Fields{"requestID": requestID, "messageID": request.ID, "traceID": traceID}).Error(errors.Wrap(err, "translate request"))
+		span.SetStatus(codes.Error, err.Error())
+		a.ack(request.ID, 0, time.Since(start), err)
+
+		return
+	}
+
+	if len(requests) == 0 {
+		log.WithFields(log.Fields{"requestID": requestID, "messageID": request.ID, "traceID": traceID}).Info("Agent: request dropped")
+	}
+
+	statusCode := 0
+
+	for _, r := range requests {
+		code, playErr := a.play(ctx, requestID, r)
+		statusCode = code
+
+		if playErr != nil && err == nil {
+			err = playErr
+		}
+	}
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	a.ack(request.ID, statusCode, time.Since(start), err)
+}
+
+// play replays a request against the target, retrying according to the
+// retry policy of its method. It returns the last status code received.
+func (a *Agent) play(ctx context.Context, requestID string, request dto.Request) (int, error) {
+	traceID := tracing.TraceID(ctx)
+
+	policy := a.retryPolicy(request.Method)
+	statusCode := 0
+	attempt := 0
 
-	retry := backoff.NewExponentialBackOff()
-	retry.MaxInterval = defaultMaxInterval
-	retry.MaxElapsedTime = a.options.Agent.RetryDelay
 	err := backoff.RetryNotify(func() error {
-		resp, err := http.DefaultClient.Do(req)
-		if resp != nil {
-			defer resp.Body.Close()
-			reqStr, _ := httputil.DumpRequest(req, true)
-			respStr, _ := httputil.DumpResponse(resp, true)
-			log.WithFields(log.Fields{"requestID": requestID, "request": string(reqStr), "response": string(respStr)}).Debug("Agent: request played")
-			if resp.StatusCode >= http.StatusBadRequest {
-				err = errors.New(fmt.Sprintf(`Server respond with "%d" code.`, resp.StatusCode))
+		attempt++
+
+		attemptCtx, attemptSpan := tracing.Tracer().Start(ctx, "replay attempt",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("http.request.method", request.Method),
+				attribute.String("url.full", a.target.url(request)),
+				attribute.Int("http.request.resend_count", attempt-1),
+			),
+		)
+
+		defer attemptSpan.End()
+
+		code, err := a.target.send(attemptCtx, requestID, request)
+		if err != nil {
+			attemptSpan.SetStatus(codes.Error, err.Error())
+
+			if _, ok := err.(*backoff.PermanentError); !ok && !policy.RetryOnError && !isRetryable(err) {
+				return backoff.Permanent(err)
 			}
+
+			return err
 		}
-		if err != nil {
+
+		statusCode = code
+		attemptSpan.SetAttributes(attribute.Int("http.response.status_code", code))
+
+		if err := a.checkResponse(policy, request, code); err != nil {
+			attemptSpan.SetStatus(codes.Error, err.Error())
+
 			return err
 		}
 
-		log.WithFields(log.Fields{"requestID": requestID}).Info("Agent: request played")
+		log.WithFields(log.Fields{"requestID": requestID, "messageID": request.ID, "traceID": traceID}).Info("Agent: request played")
 
 		return nil
-	}, retry, func(err error, d time.Duration) {
-		log.WithFields(log.Fields{"requestID": requestID}).Warn(err)
+	}, backoff.WithContext(newBackOff(policy), a.ctx), func(err error, d time.Duration) {
+		log.WithFields(log.Fields{"requestID": requestID, "traceID": traceID}).Warn(err)
 	})
 
 	if err != nil {
-		log.WithFields(log.Fields{"requestID": requestID}).Error(errors.Wrap(err, "replay request"))
+		log.WithFields(log.Fields{"requestID": requestID, "messageID": request.ID, "traceID": traceID}).Error(errors.Wrap(err, "replay request"))
+	}
+
+	return statusCode, err
+}
+
+// retryPolicy returns the retry policy defined for the given method.
+func (a *Agent) retryPolicy(method string) config.RetryOptions {
+	if policy, ok := a.options.Agent.MethodRetries[method]; ok {
+		return policy
+	}
+
+	return a.options.Agent.Retry
+}
+
+// checkResponse checks the status code of the response with the adapter,
+// then with the retry policy.
+func (a *Agent) checkResponse(policy config.RetryOptions, request dto.Request, code int) error {
+	if s, ok := a.adapter.(successAdapter); ok && s.success(request, code) {
+		return nil
+	}
+
+	return checkStatusCode(policy, code)
+}
+
+// checkStatusCode returns nil when the code is a success, a retryable error
+// when the code is retryable, and a permanent error otherwise.
+// Empty lists of codes fallback on considering codes >= 400 as retryable
+// errors.
+func checkStatusCode(policy config.RetryOptions, code int) error {
+	if (len(policy.SuccessCodes) == 0 && code < http.StatusBadRequest) || policy.SuccessCodes.Contains(code) {
+		return nil
+	}
+
+	err := errors.New(fmt.Sprintf(`Server respond with "%d" code.`, code))
+
+	if (len(policy.RetryCodes) == 0 && code >= http.StatusBadRequest) || policy.RetryCodes.Contains(code) {
+		return err
+	}
+
+	return backoff.Permanent(err)
+}
+
+func newBackOff(policy config.RetryOptions) backoff.BackOff {
+	if policy.MaxAttempts == 1 {
+		return &backoff.StopBackOff{}
+	}
+
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxInterval = defaultMaxInterval
+	retry.MaxElapsedTime = policy.Delay
+	retry.RandomizationFactor = policy.Jitter
+
+	if policy.InitialInterval > 0 {
+		retry.InitialInterval = policy.InitialInterval
 	}
+
+	if policy.MaxInterval > 0 {
+		retry.MaxInterval = policy.MaxInterval
+	}
+
+	if policy.MaxAttempts > 1 {
+		return backoff.WithMaxRetries(retry, uint64(policy.MaxAttempts-1))
+	}
+
+	return retry
 }
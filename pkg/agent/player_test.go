@@ -1,15 +1,29 @@
 package agent
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
 )
 
 func TestReplay(t *testing.T) {
@@ -21,7 +35,7 @@ func TestReplay(t *testing.T) {
 	}))
 	defer targetServer.Close()
 
-	s := NewAgent(&config.Options{
+	s, _ := NewAgent(&config.Options{
 		Agent: config.AgentOptions{
 			Endpoint: parseSafeURL(targetServer.URL),
 		},
@@ -33,3 +47,227 @@ func TestReplay(t *testing.T) {
 	assert.Equal(t, "text/plain", targetRequest.Header.Get("Content-Type"))
 	assert.Equal(t, "Hello", string(targetRequestBody))
 }
+
+func TestReplayInvalidationWithQuery(t *testing.T) {
+	var targetRequest *http.Request
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetRequest = r
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+		},
+	})
+
+	data, _ := json.Marshal(dto.NewInvalidationRequest(dto.Invalidation{URLs: []string{"https://www.example.com/a?page=2"}}))
+
+	s.replay("random", data)
+	require.NotNil(t, targetRequest)
+	assert.Equal(t, "PURGE", targetRequest.Method)
+	assert.Equal(t, "/a?page=2", targetRequest.RequestURI)
+}
+
+func TestReplayEncodedBody(t *testing.T) {
+	var targetRequestBody []byte
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetRequestBody, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+		},
+	})
+
+	request := dto.Request{Method: "POST", Path: "/", Body: []byte("Hello")}
+	require.NoError(t, request.Encode(dto.EncodingZstd))
+	data, _ := json.Marshal(request)
+
+	s.replay("random", data)
+	assert.Equal(t, "Hello", string(targetRequestBody))
+}
+
+func TestReplayMsgpack(t *testing.T) {
+	var targetRequestBody []byte
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetRequestBody, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+		},
+	})
+
+	data, err := dto.Marshal(dto.Request{Method: "POST", Path: "/", Body: []byte("Hello")}, dto.FormatMsgpack)
+	require.NoError(t, err)
+
+	s.replay("random", data)
+	assert.Equal(t, "Hello", string(targetRequestBody))
+}
+
+func TestReplaySuccessCode(t *testing.T) {
+	var calls int32
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+			Retry: config.RetryOptions{
+				Delay:           time.Second,
+				InitialInterval: time.Millisecond,
+				RetryCodes:      config.StatusCodes{{Min: 400, Max: 599}},
+				SuccessCodes:    config.StatusCodes{{Min: 200, Max: 299}},
+			},
+			MethodRetries: map[string]config.RetryOptions{
+				"PURGE": {
+					Delay:           time.Second,
+					InitialInterval: time.Millisecond,
+					RetryCodes:      config.StatusCodes{{Min: 500, Max: 599}},
+					SuccessCodes:    config.StatusCodes{{Min: 200, Max: 299}, {Min: 404, Max: 404}},
+				},
+			},
+		},
+	})
+
+	s.replay("random", []byte(`{"Method":"PURGE","Path":"/"}`))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestReplayMaxAttempts(t *testing.T) {
+	var calls int32
+	var bodies []string
+	var mu sync.Mutex
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+			Retry: config.RetryOptions{
+				MaxAttempts:     3,
+				InitialInterval: time.Millisecond,
+				RetryCodes:      config.StatusCodes{{Min: 500, Max: 599}},
+			},
+		},
+	})
+
+	s.replay("random", []byte(`{"Method":"POST","Path":"/","Body":"SGVsbG8="}`))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, []string{"Hello", "Hello", "Hello"}, bodies)
+}
+
+func TestReplayPermanentError(t *testing.T) {
+	var calls int32
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+			Retry: config.RetryOptions{
+				Delay:           time.Second,
+				InitialInterval: time.Millisecond,
+				RetryCodes:      config.StatusCodes{{Min: 500, Max: 599}},
+				SuccessCodes:    config.StatusCodes{{Min: 200, Max: 299}},
+			},
+		},
+	})
+
+	s.replay("random", []byte(`{"Method":"PURGE","Path":"/"}`))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestReplayUnixSocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "varnish.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	var targetRequest *http.Request
+	targetServer := &httptest.Server{
+		Listener: ln,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			targetRequest = r
+		})},
+	}
+	targetServer.Start()
+	defer targetServer.Close()
+
+	s, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("unix:" + socket),
+		},
+	})
+	require.NoError(t, err)
+
+	s.replay("random", []byte(`{"Method":"PURGE","Host":"example.com","Path":"/foo"}`))
+	require.NotNil(t, targetRequest)
+	assert.Equal(t, "PURGE", targetRequest.Method)
+	assert.Equal(t, "example.com", targetRequest.Host)
+	assert.Equal(t, "/foo", targetRequest.URL.Path)
+}
+
+func TestReplayTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var calls int32
+	var traceparent string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer targetServer.Close()
+
+	s, _ := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL(targetServer.URL),
+			Retry: config.RetryOptions{
+				Delay:           time.Second,
+				InitialInterval: time.Millisecond,
+			},
+		},
+	})
+
+	s.replay("random", []byte(`{"ID":"foo","Method":"PURGE","Path":"/","Trace":{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}`))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "replay attempt", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "replay attempt", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+	assert.Equal(t, "replay", spans[2].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[2].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[2].Parent().SpanID().String())
+	assert.Equal(t, spans[2].SpanContext().SpanID(), spans[1].Parent().SpanID())
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[1].SpanContext().SpanID().String()+"-01", traceparent)
+}
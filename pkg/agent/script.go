@@ -0,0 +1,363 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/version"
+)
+
+// scriptFunction is the function of the script called for each request
+const scriptFunction = "replay"
+
+// scriptAdapter runs a Starlark script on each request before handing the
+// requests it returns to the next adapter.
+//
+// The script defines a `replay(request, agent)` function which returns a
+// request, a list of requests, or None to drop the request. Scripts have no
+// access to the filesystem nor to the network, and are cancelled when they run
+// longer than the timeout.
+type scriptAdapter struct {
+	next    adapter
+	file    string
+	fn      *starlark.Function
+	agent   *starlark.Dict
+	timeout time.Duration
+}
+
+func newScriptAdapter(file string, options config.AgentOptions, next adapter) (*scriptAdapter, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scriptAdapter{
+		next:    next,
+		file:    file,
+		timeout: options.ScriptTimeout,
+	}
+
+	var globals starlark.StringDict
+	if err := s.run(func(thread *starlark.Thread) (err error) {
+		globals, err = starlark.ExecFile(thread, file, src, starlark.StringDict{"json": json.Module})
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	fn, ok := globals[scriptFunction].(*starlark.Function)
+	if !ok {
+		return nil, fmt.Errorf(`function "%s" is not defined`, scriptFunction)
+	}
+
+	if fn.NumParams() != 2 {
+		return nil, fmt.Errorf(`function "%s" must accept 2 parameters, %d given`, scriptFunction, fn.NumParams())
+	}
+
+	endpoint := ""
+	if options.Endpoint != nil {
+		endpoint = options.Endpoint.Redacted()
+	}
+
+	s.fn = fn
+	s.agent = starlark.NewDict(3)
+	s.agent.SetKey(starlark.String("id"), starlark.String(options.ID))
+	s.agent.SetKey(starlark.String("endpoint"), starlark.String(endpoint))
+	s.agent.SetKey(starlark.String("version"), starlark.String(version.Version))
+	s.agent.Freeze()
+
+	return s, nil
+}
+
+func (s *scriptAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	var value starlark.Value
+	if err := s.run(func(thread *starlark.Thread) (err error) {
+		value, err = starlark.Call(thread, s.fn, starlark.Tuple{requestToStarlark(request), s.agent}, nil)
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	scripted, err := requestsFromStarlark(value, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "script")
+	}
+
+	var requests []dto.Request
+
+	for _, r := range scripted {
+		translated, err := s.next.requests(r)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, translated...)
+	}
+
+	return requests, nil
+}
+
+func (s *scriptAdapter) success(request dto.Request, code int) bool {
+	if next, ok := s.next.(successAdapter); ok {
+		return next.success(request, code)
+	}
+
+	return false
+}
+
+// run calls f in a new thread cancelled after the timeout of the script.
+func (s *scriptAdapter) run(f func(thread *starlark.Thread) error) error {
+	thread := &starlark.Thread{
+		Name: s.file,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.WithFields(log.Fields{"script": s.file}).Info(msg)
+		},
+	}
+
+	if s.timeout > 0 {
+		timer := time.AfterFunc(s.timeout, func() {
+			thread.Cancel(fmt.Sprintf("timeout after %s", s.timeout))
+		})
+		defer timer.Stop()
+	}
+
+	err := f(thread)
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return errors.New("script: " + evalErr.Backtrace())
+	}
+
+	return errors.Wrap(err, "script")
+}
+
+// requestToStarlark converts the request into the dict given to the script.
+func requestToStarlark(request dto.Request) *starlark.Dict {
+	headers := starlark.NewDict(len(request.Header))
+	for name, values := range request.Header {
+		headers.SetKey(starlark.String(name), stringsToStarlark(values))
+	}
+
+	var invalidation starlark.Value = starlark.None
+	if request.Invalidation != nil {
+		d := starlark.NewDict(3)
+		d.SetKey(starlark.String("urls"), stringsToStarlark(request.Invalidation.URLs))
+		d.SetKey(starlark.String("bans"), stringsToStarlark(request.Invalidation.Bans))
+		d.SetKey(starlark.String("tags"), stringsToStarlark(request.Invalidation.Tags))
+		invalidation = d
+	}
+
+	d := starlark.NewDict(7)
+	d.SetKey(starlark.String("id"), starlark.String(request.ID))
+	d.SetKey(starlark.String("method"), starlark.String(request.Method))
+	d.SetKey(starlark.String("host"), starlark.String(request.Host))
+	d.SetKey(starlark.String("path"), starlark.String(request.Path))
+	d.SetKey(starlark.String("headers"), headers)
+	d.SetKey(starlark.String("body"), starlark.String(request.Body))
+	d.SetKey(starlark.String("invalidation"), invalidation)
+
+	return d
+}
+
+// requestsFromStarlark converts the value returned by the script into
+// requests. Missing fields are inherited from the original request.
+func requestsFromStarlark(value starlark.Value, original dto.Request) ([]dto.Request, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *starlark.Dict:
+		request, err := requestFromStarlark(v, original)
+		if err != nil {
+			return nil, err
+		}
+
+		return []dto.Request{request}, nil
+	case *starlark.List:
+		requests := make([]dto.Request, 0, v.Len())
+
+		for i := 0; i < v.Len(); i++ {
+			d, ok := v.Index(i).(*starlark.Dict)
+			if !ok {
+				return nil, fmt.Errorf(`unexpected "%s" in the returned list`, v.Index(i).Type())
+			}
+
+			request, err := requestFromStarlark(d, original)
+			if err != nil {
+				return nil, err
+			}
+
+			requests = append(requests, request)
+		}
+
+		return requests, nil
+	}
+
+	return nil, fmt.Errorf(`unexpected returned value "%s"`, value.Type())
+}
+
+func requestFromStarlark(d *starlark.Dict, original dto.Request) (dto.Request, error) {
+	request := original
+	request.Header = original.Header.Clone()
+
+	for _, item := range d.Items() {
+		key, ok := starlark.AsString(item[0])
+		if !ok {
+			return request, fmt.Errorf(`unexpected key "%s"`, item[0])
+		}
+
+		var err error
+
+		switch key {
+		case "id":
+			request.ID, err = stringFromStarlark(key, item[1])
+		case "method":
+			request.Method, err = stringFromStarlark(key, item[1])
+		case "host":
+			request.Host, err = stringFromStarlark(key, item[1])
+		case "path":
+			request.Path, err = stringFromStarlark(key, item[1])
+		case "body":
+			var body string
+			body, err = stringFromStarlark(key, item[1])
+			request.Body = nil
+
+			if body != "" {
+				request.Body = []byte(body)
+			}
+		case "headers":
+			request.Header, err = headersFromStarlark(item[1])
+		case "invalidation":
+			request.Invalidation, err = invalidationFromStarlark(item[1])
+		default:
+			err = fmt.Errorf(`unexpected key "%s"`, key)
+		}
+
+		if err != nil {
+			return request, err
+		}
+	}
+
+	return request, nil
+}
+
+func headersFromStarlark(value starlark.Value) (http.Header, error) {
+	d, ok := value.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf(`headers: unexpected "%s"`, value.Type())
+	}
+
+	header := http.Header{}
+
+	for _, item := range d.Items() {
+		name, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf(`headers: unexpected key "%s"`, item[0])
+		}
+
+		if s, ok := starlark.AsString(item[1]); ok {
+			header.Set(name, s)
+
+			continue
+		}
+
+		values, err := stringsFromStarlark("headers."+name, item[1])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range values {
+			header.Add(name, v)
+		}
+	}
+
+	return header, nil
+}
+
+func invalidationFromStarlark(value starlark.Value) (*dto.Invalidation, error) {
+	if value == starlark.None {
+		return nil, nil
+	}
+
+	d, ok := value.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf(`invalidation: unexpected "%s"`, value.Type())
+	}
+
+	invalidation := &dto.Invalidation{}
+
+	for _, item := range d.Items() {
+		key, _ := starlark.AsString(item[0])
+
+		var err error
+
+		switch key {
+		case "urls":
+			invalidation.URLs, err = stringsFromStarlark("invalidation.urls", item[1])
+		case "bans":
+			invalidation.Bans, err = stringsFromStarlark("invalidation.bans", item[1])
+		case "tags":
+			invalidation.Tags, err = stringsFromStarlark("invalidation.tags", item[1])
+		default:
+			err = fmt.Errorf(`invalidation: unexpected key "%s"`, item[0])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return invalidation, invalidation.Validate()
+}
+
+func stringFromStarlark(name string, value starlark.Value) (string, error) {
+	switch v := value.(type) {
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bytes:
+		return string(v), nil
+	}
+
+	return "", fmt.Errorf(`%s: expected string, got "%s"`, name, value.Type())
+}
+
+func stringsFromStarlark(name string, value starlark.Value) ([]string, error) {
+	iterable, ok := value.(starlark.Iterable)
+	if !ok {
+		return nil, fmt.Errorf(`%s: expected list, got "%s"`, name, value.Type())
+	}
+
+	var values []string
+
+	iter := iterable.Iterate()
+	defer iter.Done()
+
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		s, err := stringFromStarlark(name, elem)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, s)
+	}
+
+	return values, nil
+}
+
+func stringsToStarlark(values []string) *starlark.List {
+	elems := make([]starlark.Value, 0, len(values))
+	for _, v := range values {
+		elems = append(elems, starlark.String(v))
+	}
+
+	return starlark.NewList(elems)
+}
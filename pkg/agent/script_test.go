@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestScriptAdapter(t *testing.T) {
+	file := newTempFile(t, "replay.star", 0600, `
+def replay(request, agent):
+    if request["method"] == "GET":
+        return None
+
+    if request["method"] == "PURGE" and "," in request["path"]:
+        return [dict(request, path=p) for p in request["path"].split(",")]
+
+    headers = dict(request["headers"])
+    headers["X-Agent"] = agent["id"]
+    headers["X-Tenant"] = json.decode(request["body"])["tenant"]
+
+    return dict(request, path=request["path"].lower(), headers=headers, body="")
+`)
+
+	ad, err := newScriptAdapter(file, config.AgentOptions{ID: "agent-1", ScriptTimeout: time.Second}, rawAdapter{})
+	require.NoError(t, err)
+
+	requests, err := ad.requests(dto.Request{ID: "id", Method: "GET", Path: "/"})
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+
+	requests, err = ad.requests(dto.Request{ID: "id", Method: "PURGE", Path: "/a,/b"})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{
+		{ID: "id", Method: "PURGE", Path: "/a", Header: http.Header{}},
+		{ID: "id", Method: "PURGE", Path: "/b", Header: http.Header{}},
+	}, requests)
+
+	requests, err = ad.requests(dto.Request{
+		ID:     "id",
+		Method: "POST",
+		Path:   "/FOO",
+		Header: http.Header{"Accept": {"text/html", "application/json"}},
+		Body:   []byte(`{"tenant": "acme"}`),
+		Trace:  map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{{
+		ID:     "id",
+		Method: "POST",
+		Path:   "/foo",
+		Header: http.Header{"Accept": {"text/html", "application/json"}, "X-Agent": {"agent-1"}, "X-Tenant": {"acme"}},
+		Trace:  map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}}, requests)
+}
+
+func TestScriptAdapterInvalidation(t *testing.T) {
+	file := newTempFile(t, "replay.star", 0600, `
+def replay(request, agent):
+    invalidation = request["invalidation"]
+    return dict(request, invalidation=dict(invalidation, tags=["brand-" + t for t in invalidation["tags"]]))
+`)
+
+	ad, err := newScriptAdapter(file, config.AgentOptions{ScriptTimeout: time.Second}, varnishAdapter{})
+	require.NoError(t, err)
+
+	requests, err := ad.requests(*dto.NewInvalidationRequest(dto.Invalidation{Tags: []string{"product-42"}}))
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "brand-product-42", requests[0].Header.Get("Xkey-Purge"))
+}
+
+func TestScriptAdapterTimeout(t *testing.T) {
+	file := newTempFile(t, "replay.star", 0600, `
+def replay(request, agent):
+    for i in range(1000000000):
+        pass
+`)
+
+	ad, err := newScriptAdapter(file, config.AgentOptions{ScriptTimeout: 10 * time.Millisecond}, rawAdapter{})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = ad.requests(dto.Request{Method: "PURGE", Path: "/"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout after 10ms")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestScriptAdapterInvalid(t *testing.T) {
+	cases := map[string]struct {
+		script string
+		err    string
+	}{
+		"syntax":          {"def replay(request, agent)\n", "script: "},
+		"missing":         {"def other(request, agent):\n    pass\n", `function "replay" is not defined`},
+		"parameters":      {"def replay(request):\n    pass\n", `function "replay" must accept 2 parameters, 1 given`},
+		"load":            {"load(\"lib.star\", \"foo\")\n", "load not implemented"},
+		"filesystem":      {"def replay(request, agent):\n    return open(\"/etc/passwd\")\n", "undefined: open"},
+		"global mutation": {"seen = []\ndef replay(request, agent):\n    seen.append(request)\n", ""},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			file := newTempFile(t, "replay.star", 0600, c.script)
+
+			ad, err := newScriptAdapter(file, config.AgentOptions{ScriptTimeout: time.Second}, rawAdapter{})
+			if c.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), c.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			_, err = ad.requests(dto.Request{Method: "PURGE", Path: "/"})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "frozen")
+		})
+	}
+}
+
+func TestScriptAdapterInvalidResult(t *testing.T) {
+	cases := map[string]struct {
+		result string
+		err    string
+	}{
+		"type":         {`"/foo"`, `script: unexpected returned value "string"`},
+		"list":         {`["/foo"]`, `script: unexpected "string" in the returned list`},
+		"key":          {`dict(request, url="/foo")`, `script: unexpected key "url"`},
+		"field":        {`dict(request, path=42)`, `script: path: expected string, got "int"`},
+		"header":       {`dict(request, headers={"X-Foo": 42})`, `script: headers.X-Foo: expected list, got "int"`},
+		"invalidation": {`dict(request, invalidation={})`, `script: empty invalidation`},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			file := newTempFile(t, "replay.star", 0600, "def replay(request, agent):\n    return "+c.result+"\n")
+
+			ad, err := newScriptAdapter(file, config.AgentOptions{ScriptTimeout: time.Second}, rawAdapter{})
+			require.NoError(t, err)
+
+			_, err = ad.requests(dto.Request{Method: "PURGE", Path: "/"})
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestReplayScript(t *testing.T) {
+	var calls int32
+	var path string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		path = r.URL.Path
+	}))
+	defer targetServer.Close()
+
+	file := newTempFile(t, "replay.star", 0600, `
+def replay(request, agent):
+    if request["path"].startswith("/private"):
+        return None
+
+    return dict(request, path="/cache" + request["path"])
+`)
+
+	s, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint:      parseSafeURL(targetServer.URL),
+			Script:        file,
+			ScriptTimeout: time.Second,
+		},
+	})
+	require.NoError(t, err)
+
+	s.replay("random", []byte(`{"ID":"1","Method":"PURGE","Path":"/private/foo"}`))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	s.replay("random", []byte(`{"ID":"2","Method":"PURGE","Path":"/foo"}`))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, "/cache/foo", path)
+}
+
+func TestNewAgentInvalidScript(t *testing.T) {
+	_, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("http://localhost"),
+			Script:   "/path/to/missing.star",
+		},
+	})
+	assert.EqualError(t, err, "agent: load script: open /path/to/missing.star: no such file or directory")
+}
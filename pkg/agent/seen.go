@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"sync"
+)
+
+// seenSet is a bounded set of message IDs. When the set is full, the oldest
+// IDs are forgotten first.
+type seenSet struct {
+	mu    sync.Mutex
+	ids   map[string]struct{}
+	ring  []string
+	index int
+}
+
+// add registers the ID in the set. It returns false when the ID was already
+// registered.
+func (s *seenSet) add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+
+	if old := s.ring[s.index]; old != "" {
+		delete(s.ids, old)
+	}
+
+	s.ring[s.index] = id
+	s.ids[id] = struct{}{}
+	s.index = (s.index + 1) % len(s.ring)
+
+	return true
+}
+
+func newSeenSet(size int) *seenSet {
+	if size < 1 {
+		size = 1
+	}
+
+	return &seenSet{
+		ids:  make(map[string]struct{}, size),
+		ring: make([]string, size),
+	}
+}
@@ -0,0 +1,20 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeenSet(t *testing.T) {
+	s := newSeenSet(2)
+
+	assert.True(t, s.add("1"))
+	assert.False(t, s.add("1"))
+	assert.True(t, s.add("2"))
+	assert.True(t, s.add("3"))
+
+	// "1" has been evicted
+	assert.True(t, s.add("1"))
+	assert.False(t, s.add("3"))
+}
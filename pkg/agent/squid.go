@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// squidAdapter translates the purges into the requests understood by Squid:
+// PURGE requests with the absolute URL of the object in the request line.
+// Other requests are replayed as is.
+type squidAdapter struct{}
+
+func (squidAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	if request.Invalidation == nil {
+		if request.Method == "PURGE" && request.Host != "" {
+			request.Path = "http://" + request.Host + request.Path
+		}
+
+		return []dto.Request{request}, nil
+	}
+
+	if len(request.Invalidation.Bans) > 0 || len(request.Invalidation.Tags) > 0 {
+		return nil, errors.New("bans and tags are not supported by squid")
+	}
+
+	requests := make([]dto.Request, 0, len(request.Invalidation.URLs))
+
+	for _, rawURL := range request.Invalidation.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid URL")
+		}
+
+		if !u.IsAbs() {
+			return nil, errors.Errorf(`squid requires absolute URLs, got "%s"`, rawURL)
+		}
+
+		if strings.Contains(u.Path, "*") {
+			return nil, errors.Errorf(`wildcards are not supported by squid, got "%s"`, rawURL)
+		}
+
+		requests = append(requests, derive(request, "PURGE", u.Host, u.Scheme+"://"+u.Host+pathWithQuery(u), http.Header{}))
+	}
+
+	return requests, nil
+}
+
+// success considers the purge of an uncached URL as a success.
+func (squidAdapter) success(request dto.Request, code int) bool {
+	return request.Method == "PURGE" && code == http.StatusNotFound
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestSquidAdapter(t *testing.T) {
+	requests, err := squidAdapter{}.requests(dto.Request{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "/foo"})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "http://www.example.com/foo"}}, requests)
+
+	requests, err = squidAdapter{}.requests(dto.Request{ID: "id", Invalidation: &dto.Invalidation{
+		URLs: []string{"https://www.example.com/foo"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{
+		{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "https://www.example.com/foo", Header: http.Header{}},
+	}, requests)
+
+	_, err = squidAdapter{}.requests(dto.Request{Invalidation: &dto.Invalidation{URLs: []string{"/foo"}}})
+	assert.EqualError(t, err, `squid requires absolute URLs, got "/foo"`)
+
+	_, err = squidAdapter{}.requests(dto.Request{Invalidation: &dto.Invalidation{URLs: []string{"http://www.example.com/*"}}})
+	assert.EqualError(t, err, `wildcards are not supported by squid, got "http://www.example.com/*"`)
+
+	_, err = squidAdapter{}.requests(dto.Request{Invalidation: &dto.Invalidation{Bans: []string{"^/"}}})
+	assert.EqualError(t, err, "bans and tags are not supported by squid")
+}
+
+func TestReplaySquid(t *testing.T) {
+	var requestURI, host string
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		host = r.Host
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer targetServer.Close()
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("squid+" + targetServer.URL),
+			Retry: config.RetryOptions{
+				MaxAttempts: 1,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// the scheme of the invalidated URL is part of the cache key, whatever
+	// the scheme of the endpoint
+	for _, u := range []string{"http://www.example.com/foo", "https://www.example.com/foo"} {
+		data, _ := dto.Marshal(*dto.NewInvalidationRequest(dto.Invalidation{URLs: []string{u}}), dto.FormatJSON)
+		a.replay("random", data)
+
+		assert.Equal(t, u, requestURI)
+		assert.Equal(t, "www.example.com", host)
+	}
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/version"
+)
+
+// publishStatus pushes the status event into the status topic.
+func (a *Agent) publishStatus(status dto.Status) {
+	if a.publisher == nil {
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Error(errors.Wrap(err, "agent: encode status"))
+
+		return
+	}
+
+	if err := a.publisher.Publish(hub.Message{
+		Topic:  a.statusTopic(),
+		Target: a.options.Hub.Target,
+		Data:   data,
+	}); err != nil {
+		log.Warn(errors.Wrap(err, "agent: publish status"))
+	}
+}
+
+// ack publishes the outcome of the replay of a message.
+func (a *Agent) ack(messageID string, statusCode int, latency time.Duration, err error) {
+	if messageID == "" {
+		return
+	}
+
+	ack := &dto.Ack{
+		MessageID:  messageID,
+		Agent:      a.options.Agent.ID,
+		Success:    err == nil,
+		StatusCode: statusCode,
+		Latency:    latency,
+		Time:       time.Now(),
+	}
+
+	if err != nil {
+		ack.Error = err.Error()
+	}
+
+	a.publishStatus(dto.Status{Ack: ack})
+}
+
+// heartbeat periodically publishes the presence of the agent until the
+// context is canceled.
+func (a *Agent) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(a.options.Agent.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		a.publishStatus(dto.Status{Heartbeat: a.newHeartbeat()})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newHeartbeat describes the identity of the agent and its progress.
+func (a *Agent) newHeartbeat() *dto.Heartbeat {
+	heartbeat := &dto.Heartbeat{
+		Agent:       a.options.Agent.ID,
+		Version:     version.Version,
+		LastEventID: map[string]string{},
+		Time:        time.Now(),
+	}
+
+	if a.options.Agent.Endpoint != nil {
+		endpoint := *a.options.Agent.Endpoint
+		endpoint.User = nil
+		heartbeat.Endpoint = endpoint.String()
+	}
+
+	for hubName, t := range a.trackers {
+		if lastEventID := t.lastEventID(); lastEventID != "" {
+			heartbeat.LastEventID[hubName] = lastEventID
+		}
+
+		pending, lag := t.lag()
+		heartbeat.Pending += pending
+
+		if lag > heartbeat.Lag {
+			heartbeat.Lag = lag
+		}
+	}
+
+	return heartbeat
+}
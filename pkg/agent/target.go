@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/headerpolicy"
+	"github.com/jderusse/http-broadcast/pkg/redact"
+	"github.com/jderusse/http-broadcast/pkg/tracing"
+)
+
+// target sends the requests to the cache.
+type target interface {
+	// send sends the request and returns the status code of the response.
+	send(ctx context.Context, requestID string, request dto.Request) (int, error)
+	// url returns the URL the request is sent to.
+	url(request dto.Request) string
+}
+
+// isRetryable returns whether the error of a target must be retried regardless
+// of the RetryOnError policy.
+func isRetryable(err error) bool {
+	r, ok := err.(interface{ retryable() bool })
+
+	return ok && r.retryable()
+}
+
+// newTarget returns the target selected by the scheme of the endpoint.
+func newTarget(endpoint *url.URL, options *config.Options) (target, error) {
+	if endpoint != nil {
+		switch endpoint.Scheme {
+		case "varnishadm":
+			return newVarnishadmTarget(endpoint, options.Agent.VarnishSecretFile, options.Agent.Client.Timeout), nil
+		case "exec":
+			return newExecTarget(endpoint, options.Agent.ExecArgs, options.Agent.Client.Timeout, options.Agent.ExecRetryCodes, headerpolicy.New(options.Agent.Headers)), nil
+		}
+	}
+
+	clientOptions := options.Agent.Client
+
+	if endpoint != nil && endpoint.Scheme == "unix" {
+		clientOptions.UnixSocket = endpoint.Path
+		if clientOptions.UnixSocket == "" {
+			clientOptions.UnixSocket = endpoint.Opaque
+		}
+
+		// the host is ignored when dialing the socket
+		endpoint = &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
+	}
+
+	client, err := newHTTPClient(clientOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "agent: create HTTP client")
+	}
+
+	return &httpTarget{
+		client:       client,
+		endpoint:     endpoint,
+		redactor:     redact.New(options.Log),
+		headerPolicy: headerpolicy.New(options.Agent.Headers),
+	}, nil
+}
+
+// httpTarget replays the requests with an HTTP client.
+type httpTarget struct {
+	client       *http.Client
+	endpoint     *url.URL
+	redactor     *redact.Redactor
+	headerPolicy *headerpolicy.Policy
+}
+
+// url returns the URL of the request. Requests which path is an absolute URL
+// (ie. "http://www.example.com/foo") are sent to the endpoint with that URL in
+// the request line, as expected by proxies. The query string of the path, if
+// any, replaces the one of the endpoint.
+func (t *httpTarget) url(request dto.Request) string {
+	if isAbsoluteURL(request.Path) {
+		return request.Path
+	}
+
+	path, query, hasQuery := strings.Cut(request.Path, "?")
+
+	targetURL := *t.endpoint
+	targetURL.Path = fmt.Sprintf("%s/%s", strings.TrimRight(t.endpoint.Path, "/"), strings.TrimLeft(path, "/"))
+
+	if hasQuery {
+		targetURL.RawQuery = query
+	}
+
+	return targetURL.String()
+}
+
+func (t *httpTarget) send(ctx context.Context, requestID string, request dto.Request) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, request.Method, t.url(request), bytes.NewBuffer(request.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	if isAbsoluteURL(request.Path) {
+		req.URL = &url.URL{
+			Scheme: t.endpoint.Scheme,
+			Host:   t.endpoint.Host,
+			User:   t.endpoint.User,
+			Opaque: request.Path,
+		}
+	}
+
+	req.Header = t.headerPolicy.Apply(request.Header)
+	req.Host = request.Host
+
+	tracing.Propagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.WithFields(log.Fields{"requestID": requestID, "request": t.redactor.DumpRequest(req), "response": t.redactor.DumpResponse(resp)}).Debug("Agent: request played")
+	}
+
+	return resp.StatusCode, nil
+}
+
+func isAbsoluteURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
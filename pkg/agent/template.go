@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+var templateFuncs = template.FuncMap{
+	"join":      func(elems []string, sep string) string { return strings.Join(elems, sep) },
+	"quoteMeta": regexp.QuoteMeta,
+}
+
+// requestTemplate describes the request sent to the target for an
+// invalidation. Host, path, headers and body are Go templates.
+type requestTemplate struct {
+	Method  string            `json:"method"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// invalidationTemplates stores the templates of each kind of invalidation.
+type invalidationTemplates struct {
+	URLs *requestTemplate `json:"urls"`
+	Bans *requestTemplate `json:"bans"`
+	Tags *requestTemplate `json:"tags"`
+}
+
+// templateData is the data given to the templates: URL, Host and Path are
+// defined for the URLs, Ban for the bans, and Tags for the tags.
+type templateData struct {
+	ID   string
+	URL  string
+	Host string
+	Path string
+	Ban  string
+	Tags []string
+}
+
+// compiledTemplate is a parsed requestTemplate.
+type compiledTemplate struct {
+	method  string
+	host    *template.Template
+	path    *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+func compileTemplate(name string, t *requestTemplate) (*compiledTemplate, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	if t.Method == "" {
+		return nil, errors.Errorf("%s: missing method", name)
+	}
+
+	parse := func(field string, text string) (*template.Template, error) {
+		tpl, err := template.New(name + "." + field).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+
+		return tpl, errors.Wrap(err, name)
+	}
+
+	c := &compiledTemplate{method: t.Method, headers: map[string]*template.Template{}}
+
+	var err error
+	if c.host, err = parse("host", t.Host); err != nil {
+		return nil, err
+	}
+
+	if c.path, err = parse("path", t.Path); err != nil {
+		return nil, err
+	}
+
+	if c.body, err = parse("body", t.Body); err != nil {
+		return nil, err
+	}
+
+	for name, value := range t.Headers {
+		if c.headers[name], err = parse("headers."+name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *compiledTemplate) request(request dto.Request, data templateData) (dto.Request, error) {
+	execute := func(t *template.Template) (string, error) {
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+
+		return buf.String(), err
+	}
+
+	host, err := execute(c.host)
+	if err != nil {
+		return dto.Request{}, err
+	}
+
+	path, err := execute(c.path)
+	if err != nil {
+		return dto.Request{}, err
+	}
+
+	body, err := execute(c.body)
+	if err != nil {
+		return dto.Request{}, err
+	}
+
+	header := http.Header{}
+
+	for name, t := range c.headers {
+		value, err := execute(t)
+		if err != nil {
+			return dto.Request{}, err
+		}
+
+		header.Set(name, value)
+	}
+
+	r := derive(request, c.method, host, path, header)
+	if body != "" {
+		r.Body = []byte(body)
+	}
+
+	return r, nil
+}
+
+// templateAdapter translates the invalidations with templates. Invalidations
+// without template, and other requests, are translated by the next adapter.
+type templateAdapter struct {
+	urls *compiledTemplate
+	bans *compiledTemplate
+	tags *compiledTemplate
+	next adapter
+}
+
+// newTemplateAdapter loads the templates defined in the given JSON file.
+func newTemplateAdapter(file string, next adapter) (*templateAdapter, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates invalidationTemplates
+	if err := json.Unmarshal(b, &templates); err != nil {
+		return nil, err
+	}
+
+	a := &templateAdapter{next: next}
+
+	if a.urls, err = compileTemplate("urls", templates.URLs); err != nil {
+		return nil, err
+	}
+
+	if a.bans, err = compileTemplate("bans", templates.Bans); err != nil {
+		return nil, err
+	}
+
+	if a.tags, err = compileTemplate("tags", templates.Tags); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *templateAdapter) success(request dto.Request, code int) bool {
+	s, ok := a.next.(successAdapter)
+
+	return ok && s.success(request, code)
+}
+
+func (a *templateAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	if request.Invalidation == nil {
+		return a.next.requests(request)
+	}
+
+	var requests []dto.Request
+
+	remaining := *request.Invalidation
+
+	if a.urls != nil {
+		for _, rawURL := range remaining.URLs {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid URL")
+			}
+
+			r, err := a.urls.request(request, templateData{ID: request.ID, URL: rawURL, Host: u.Host, Path: pathWithQuery(u)})
+			if err != nil {
+				return nil, err
+			}
+
+			requests = append(requests, r)
+		}
+
+		remaining.URLs = nil
+	}
+
+	if a.bans != nil {
+		for _, ban := range remaining.Bans {
+			r, err := a.bans.request(request, templateData{ID: request.ID, Ban: ban})
+			if err != nil {
+				return nil, err
+			}
+
+			requests = append(requests, r)
+		}
+
+		remaining.Bans = nil
+	}
+
+	if a.tags != nil && len(remaining.Tags) > 0 {
+		r, err := a.tags.request(request, templateData{ID: request.ID, Tags: remaining.Tags})
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, r)
+		remaining.Tags = nil
+	}
+
+	if len(remaining.URLs) == 0 && len(remaining.Bans) == 0 && len(remaining.Tags) == 0 {
+		return requests, nil
+	}
+
+	request.Invalidation = &remaining
+
+	next, err := a.next.requests(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(requests, next...), nil
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestTemplateAdapter(t *testing.T) {
+	file := newTempFile(t, "templates.json", 0600, `{
+		"urls": {"method": "PURGE", "host": "{{ .Host }}", "path": "/purge{{ .Path }}"},
+		"tags": {"method": "POST", "path": "/invalidate", "headers": {"Surrogate-Key": "{{ join .Tags \" \" }}"}, "body": "{{ .ID }}"}
+	}`)
+
+	ad, err := newTemplateAdapter(file, varnishAdapter{})
+	require.NoError(t, err)
+
+	request := dto.Request{ID: "id", Method: "PURGE", Path: "/foo"}
+	requests, err := ad.requests(request)
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{request}, requests)
+	assert.False(t, ad.success(request, 404))
+
+	ad.next = nginxAdapter{}
+	assert.True(t, ad.success(request, 404))
+	ad.next = varnishAdapter{}
+
+	requests, err = ad.requests(dto.Request{ID: "id", Invalidation: &dto.Invalidation{
+		URLs: []string{"https://www.example.com/foo", "https://www.example.com/bar?page=2"},
+		Bans: []string{"^/products/"},
+		Tags: []string{"product-42", "category-7"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{
+		{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "/purge/foo", Header: http.Header{}},
+		{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "/purge/bar?page=2", Header: http.Header{}},
+		{ID: "id", Method: "POST", Path: "/invalidate", Header: http.Header{"Surrogate-Key": []string{"product-42 category-7"}}, Body: []byte("id")},
+		{ID: "id", Method: "BAN", Path: "/", Header: http.Header{"X-Url": []string{"^/products/"}}},
+	}, requests)
+}
+
+func TestTemplateAdapterInvalid(t *testing.T) {
+	for content, expected := range map[string]string{
+		`{"tags": {"path": "/"}}`:                        "tags: missing method",
+		`{"bans": {"method": "BAN", "path": "{{ .Ban"}}`: `bans: template: bans.path:1: unclosed action`,
+		`{"bans": `: "unexpected end of JSON input",
+	} {
+		file := newTempFile(t, "templates.json", 0600, content)
+
+		_, err := newTemplateAdapter(file, httpAdapter{})
+		assert.EqualError(t, err, expected)
+	}
+
+	_, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint:              parseSafeURL("http://127.0.0.1:6081"),
+			InvalidationTemplates: "/does/not/exists",
+		},
+	})
+	assert.EqualError(t, err, "agent: load invalidation templates: open /does/not/exists: no such file or directory")
+}
+
+func TestTemplateAdapterExecutionError(t *testing.T) {
+	file := newTempFile(t, "templates.json", 0600, `{"bans": {"method": "BAN", "path": "{{ .Unknown }}"}}`)
+
+	ad, err := newTemplateAdapter(file, httpAdapter{})
+	require.NoError(t, err)
+
+	_, err = ad.requests(dto.Request{Invalidation: &dto.Invalidation{Bans: []string{"^/"}}})
+	assert.Error(t, err)
+}
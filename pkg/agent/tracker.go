@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tracker keeps track of the events being replayed in the order they were
+// received, in order to wait for them and to know the last event ID which
+// has been fully processed.
+type tracker struct {
+	mu         sync.Mutex
+	pending    []*trackedEvent
+	checkpoint string
+	changed    chan struct{}
+}
+
+type trackedEvent struct {
+	id      string
+	done    bool
+	started time.Time
+}
+
+// start registers a new event in the tracker.
+func (t *tracker) start(id string) *trackedEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := &trackedEvent{id: id, started: time.Now()}
+	t.pending = append(t.pending, e)
+
+	return e
+}
+
+// finish marks an event as processed and moves the checkpoint forward.
+func (t *tracker) finish(e *trackedEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e.done = true
+	for len(t.pending) > 0 && t.pending[0].done {
+		if t.pending[0].id != "" {
+			t.checkpoint = t.pending[0].id
+		}
+
+		t.pending = t.pending[1:]
+	}
+
+	if t.changed != nil {
+		close(t.changed)
+		t.changed = nil
+	}
+}
+
+// lastEventID returns the ID of the last event processed such as all the
+// previous events have been processed too.
+func (t *tracker) lastEventID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.checkpoint
+}
+
+// lag returns the number of events being processed, and the time elapsed
+// since the oldest of them has been received.
+func (t *tracker) lag() (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) == 0 {
+		return 0, 0
+	}
+
+	return len(t.pending), time.Since(t.pending[0].started)
+}
+
+// wait blocks until all the events are processed or the context is done.
+func (t *tracker) wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if len(t.pending) == 0 {
+			t.mu.Unlock()
+
+			return nil
+		}
+
+		if t.changed == nil {
+			t.changed = make(chan struct{})
+		}
+
+		changed := t.changed
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerCheckpoint(t *testing.T) {
+	var tr tracker
+
+	e1 := tr.start("1")
+	e2 := tr.start("2")
+	e3 := tr.start("3")
+
+	assert.Equal(t, "", tr.lastEventID())
+
+	tr.finish(e2)
+	assert.Equal(t, "", tr.lastEventID())
+
+	tr.finish(e1)
+	assert.Equal(t, "2", tr.lastEventID())
+
+	tr.finish(e3)
+	assert.Equal(t, "3", tr.lastEventID())
+}
+
+func TestTrackerWait(t *testing.T) {
+	var tr tracker
+
+	assert.NoError(t, tr.wait(context.Background()))
+
+	e := tr.start("1")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tr.finish(e)
+	}()
+
+	assert.NoError(t, tr.wait(context.Background()))
+}
+
+func TestTrackerWaitTimeout(t *testing.T) {
+	var tr tracker
+
+	tr.start("1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, tr.wait(ctx))
+}
+
+func TestTrackerLag(t *testing.T) {
+	var tr tracker
+
+	pending, lag := tr.lag()
+	assert.Equal(t, 0, pending)
+	assert.Equal(t, time.Duration(0), lag)
+
+	e1 := tr.start("1")
+	tr.start("2")
+	time.Sleep(10 * time.Millisecond)
+
+	pending, lag = tr.lag()
+	assert.Equal(t, 2, pending)
+	assert.GreaterOrEqual(t, int64(lag), int64(10*time.Millisecond))
+
+	tr.finish(e1)
+
+	pending, _ = tr.lag()
+	assert.Equal(t, 1, pending)
+}
@@ -4,4 +4,12 @@ import (
 	"time"
 )
 
-const defaultMaxInterval = 5 * time.Second
+const (
+	defaultMaxInterval = 5 * time.Second
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+	defaultSeenSetSize = 10000
+	// defaultExecWaitDelay is the delay to wait for the output of a command
+	// once it is killed, ie. when children still hold the output open
+	defaultExecWaitDelay = time.Second
+)
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// Headers of the requests understood by the reference VCL
+const (
+	varnishBanURLHeader    = "X-Url"
+	varnishXkeyPurgeHeader = "Xkey-Purge"
+)
+
+// varnishAdapter translates invalidations into the requests understood by
+// the reference VCL: PURGE of URLs, BAN of URL patterns and purge of xkey
+// tags. Other requests are replayed as is.
+type varnishAdapter struct{}
+
+func (varnishAdapter) requests(request dto.Request) ([]dto.Request, error) {
+	if request.Invalidation == nil {
+		return []dto.Request{request}, nil
+	}
+
+	requests, err := purgeRequests(request, request.Invalidation.URLs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ban := range request.Invalidation.Bans {
+		requests = append(requests, derive(request, "BAN", "", "/", http.Header{
+			varnishBanURLHeader: []string{ban},
+		}))
+	}
+
+	if len(request.Invalidation.Tags) > 0 {
+		requests = append(requests, derive(request, "PURGE", "", "/", http.Header{
+			varnishXkeyPurgeHeader: []string{strings.Join(request.Invalidation.Tags, " ")},
+		}))
+	}
+
+	return requests, nil
+}
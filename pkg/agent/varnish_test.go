@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestVarnishAdapter(t *testing.T) {
+	request := dto.Request{ID: "id", Method: "PURGE", Path: "/foo"}
+	requests, err := varnishAdapter{}.requests(request)
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{request}, requests)
+
+	requests, err = varnishAdapter{}.requests(dto.Request{ID: "id", Invalidation: &dto.Invalidation{
+		URLs: []string{"https://www.example.com/foo"},
+		Bans: []string{"^/products/", "^/categories/"},
+		Tags: []string{"product-42", "category-7"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Request{
+		{ID: "id", Method: "PURGE", Host: "www.example.com", Path: "/foo", Header: http.Header{}},
+		{ID: "id", Method: "BAN", Path: "/", Header: http.Header{"X-Url": []string{"^/products/"}}},
+		{ID: "id", Method: "BAN", Path: "/", Header: http.Header{"X-Url": []string{"^/categories/"}}},
+		{ID: "id", Method: "PURGE", Path: "/", Header: http.Header{"Xkey-Purge": []string{"product-42 category-7"}}},
+	}, requests)
+}
+
+func TestReplayVarnish(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, r.Method+" "+r.Host+r.URL.Path+" "+r.Header.Get("X-Url")+r.Header.Get("Xkey-Purge"))
+	}))
+	defer targetServer.Close()
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint: parseSafeURL("varnish+" + targetServer.URL),
+		},
+	})
+	require.NoError(t, err)
+
+	data, _ := dto.Marshal(*dto.NewInvalidationRequest(dto.Invalidation{
+		URLs: []string{"http://www.example.com/foo"},
+		Bans: []string{"^/products/"},
+		Tags: []string{"product-42"},
+	}), dto.FormatJSON)
+	a.replay("random", data)
+
+	host := parseSafeURL(targetServer.URL).Host
+	assert.Equal(t, []string{
+		"PURGE www.example.com/foo ",
+		"BAN " + host + "/ ^/products/",
+		"PURGE " + host + "/ product-42",
+	}, received)
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// Status codes of the Varnish CLI
+const (
+	varnishCLIOK   = 200
+	varnishCLIAuth = 107
+	varnishCLICant = 300
+)
+
+// varnishadmTarget issues bans through the management port of Varnish,
+// using the protocol of varnishadm.
+type varnishadmTarget struct {
+	addr       string
+	secretFile string
+	timeout    time.Duration
+	dialer     net.Dialer
+}
+
+func newVarnishadmTarget(endpoint *url.URL, secretFile string, timeout time.Duration) *varnishadmTarget {
+	return &varnishadmTarget{
+		addr:       endpoint.Host,
+		secretFile: secretFile,
+		timeout:    timeout,
+		dialer:     net.Dialer{Timeout: defaultDialTimeout},
+	}
+}
+
+func (t *varnishadmTarget) url(request dto.Request) string {
+	return "varnishadm://" + t.addr
+}
+
+func (t *varnishadmTarget) send(ctx context.Context, requestID string, request dto.Request) (int, error) {
+	command, err := banCommand(request)
+	if err != nil {
+		return 0, backoff.Permanent(err)
+	}
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+
+		defer cancel()
+	}
+
+	conn, err := t.dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	cli := &varnishCLI{r: bufio.NewReader(conn), w: conn}
+
+	code, body, err := cli.read()
+	if err != nil {
+		return 0, err
+	}
+
+	if code == varnishCLIAuth {
+		if code, body, err = t.authenticate(cli, body); err != nil {
+			return 0, err
+		}
+	}
+
+	if code != varnishCLIOK {
+		return code, cliError(code, body)
+	}
+
+	if code, body, err = cli.exec(command); err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{"requestID": requestID, "command": command, "code": code, "response": body}).Debug("Agent: command executed")
+
+	if code != varnishCLIOK {
+		return code, cliError(code, body)
+	}
+
+	return code, nil
+}
+
+// authenticate answers the challenge sent by Varnish with the secret file.
+func (t *varnishadmTarget) authenticate(cli *varnishCLI, body string) (int, string, error) {
+	if t.secretFile == "" {
+		return 0, "", backoff.Permanent(errors.New("varnishadm: authentication required, but no secret file configured"))
+	}
+
+	secret, err := ioutil.ReadFile(t.secretFile)
+	if err != nil {
+		return 0, "", backoff.Permanent(errors.Wrap(err, "varnishadm: read secret file"))
+	}
+
+	challenge := strings.SplitN(body, "\n", 2)[0]
+
+	h := sha256.New()
+	io.WriteString(h, challenge+"\n")
+	h.Write(secret)
+	io.WriteString(h, challenge+"\n")
+
+	return cli.exec("auth " + hex.EncodeToString(h.Sum(nil)))
+}
+
+// cliError returns the error matching a status code of the CLI. Only the
+// failures of Varnish are retried, not the invalid commands.
+func cliError(code int, body string) error {
+	err := errors.New(strings.TrimSpace(fmt.Sprintf("varnishadm: %d %s", code, strings.TrimSpace(body))))
+	if code < varnishCLICant {
+		return backoff.Permanent(err)
+	}
+
+	return err
+}
+
+// banCommand returns the ban command matching a request translated by the
+// varnishAdapter.
+func banCommand(request dto.Request) (string, error) {
+	var args []string
+
+	switch {
+	case request.Method == "PURGE" && request.Header.Get(varnishXkeyPurgeHeader) != "":
+		tags := strings.Fields(request.Header.Get(varnishXkeyPurgeHeader))
+		for i, tag := range tags {
+			tags[i] = regexp.QuoteMeta(tag)
+		}
+
+		args = []string{"obj.http.xkey", "~", cliQuote(`(^|\s)(` + strings.Join(tags, "|") + `)($|\s)`)}
+	case request.Method == "BAN" && request.Header.Get(varnishBanURLHeader) != "":
+		args = []string{"obj.http.X-Url", "~", cliQuote(request.Header.Get(varnishBanURLHeader))}
+	case request.Method == "PURGE" || request.Method == "BAN":
+		args = []string{"req.url", "==", cliQuote(request.Path)}
+		if request.Host != "" {
+			args = append([]string{"req.http.host", "==", cliQuote(request.Host), "&&"}, args...)
+		}
+	default:
+		return "", fmt.Errorf(`unsupported method "%s"`, request.Method)
+	}
+
+	return "ban " + strings.Join(args, " "), nil
+}
+
+// cliQuote quotes an argument of a CLI command.
+func cliQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// varnishCLI reads and writes messages of the Varnish CLI protocol.
+type varnishCLI struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// exec sends a command and returns the response.
+func (c *varnishCLI) exec(command string) (int, string, error) {
+	if _, err := io.WriteString(c.w, command+"\n"); err != nil {
+		return 0, "", err
+	}
+
+	return c.read()
+}
+
+// read returns a response: a status line "<code> <length>\n" followed by a
+// body of <length> bytes and a new line.
+func (c *varnishCLI) read() (int, string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return 0, "", err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return 0, "", fmt.Errorf("varnishadm: invalid status line %q", line)
+	}
+
+	code, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", errors.Wrap(err, "varnishadm: invalid status code")
+	}
+
+	length, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", errors.Wrap(err, "varnishadm: invalid length")
+	}
+
+	body := make([]byte, length+1)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, "", err
+	}
+
+	return code, string(body[:length]), nil
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+const fakeChallenge = "abcdefghijklmnopqrstuvwxyzabcdef"
+
+// fakeVarnishCLI is a minimal implementation of the management port of
+// Varnish, authenticating clients with a secret and recording the commands.
+type fakeVarnishCLI struct {
+	ln       net.Listener
+	secret   string
+	mu       sync.Mutex
+	commands []string
+	code     int
+}
+
+func newFakeVarnishCLI(t *testing.T, secret string) *fakeVarnishCLI {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeVarnishCLI{ln: ln, secret: secret, code: varnishCLIOK}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeVarnishCLI) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	write := func(code int, body string) {
+		fmt.Fprintf(conn, "%-3d %-8d\n%s\n", code, len(body), body)
+	}
+
+	write(varnishCLIAuth, fakeChallenge+"\n\nAuthentication required.\n")
+
+	line, _ := r.ReadString('\n')
+	h := sha256.Sum256([]byte(fakeChallenge + "\n" + f.secret + fakeChallenge + "\n"))
+	if strings.TrimSpace(line) != "auth "+hex.EncodeToString(h[:]) {
+		write(varnishCLIAuth, fakeChallenge+"\n\nAuthentication required.\n")
+
+		return
+	}
+
+	write(varnishCLIOK, "-----------------------------\nVarnish Cache CLI 1.0\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.TrimSuffix(line, "\n"))
+		code := f.code
+		f.mu.Unlock()
+
+		write(code, "")
+	}
+}
+
+func (f *fakeVarnishCLI) setCode(code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.code = code
+}
+
+func (f *fakeVarnishCLI) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.commands
+}
+
+func TestReplayVarnishadm(t *testing.T) {
+	cli := newFakeVarnishCLI(t, "s3cr3t\n")
+	defer cli.ln.Close()
+
+	secretFile := newTempFile(t, "secret", 0600, "s3cr3t\n")
+
+	a, err := NewAgent(&config.Options{
+		Agent: config.AgentOptions{
+			Endpoint:          parseSafeURL("varnishadm://" + cli.ln.Addr().String()),
+			VarnishSecretFile: secretFile,
+		},
+	})
+	require.NoError(t, err)
+
+	data, _ := dto.Marshal(*dto.NewInvalidationRequest(dto.Invalidation{
+		URLs: []string{"http://www.example.com/foo"},
+		Bans: []string{`^/products/\d+`},
+		Tags: []string{"product-42", "category.7"},
+	}), dto.FormatJSON)
+	a.replay("random", data)
+
+	a.replay("random", []byte(`{"Method":"PURGE","Host":"www.example.com","Path":"/bar"}`))
+
+	assert.Equal(t, []string{
+		`ban req.http.host == "www.example.com" && req.url == "/foo"`,
+		`ban obj.http.X-Url ~ "^/products/\\d+"`,
+		`ban obj.http.xkey ~ "(^|\\s)(product-42|category\\.7)($|\\s)"`,
+		`ban req.http.host == "www.example.com" && req.url == "/bar"`,
+	}, cli.recorded())
+}
+
+func TestVarnishadmTargetAuthenticationFailure(t *testing.T) {
+	cli := newFakeVarnishCLI(t, "s3cr3t\n")
+	defer cli.ln.Close()
+
+	secretFile := newTempFile(t, "secret", 0600, "wrong\n")
+
+	target := newVarnishadmTarget(parseSafeURL("varnishadm://"+cli.ln.Addr().String()), secretFile, 0)
+
+	code, err := target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.Equal(t, varnishCLIAuth, code)
+	require.Error(t, err)
+	assert.IsType(t, &backoff.PermanentError{}, err)
+
+	target = newVarnishadmTarget(parseSafeURL("varnishadm://"+cli.ln.Addr().String()), "", 0)
+	_, err = target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.EqualError(t, err, "varnishadm: authentication required, but no secret file configured")
+	assert.Empty(t, cli.recorded())
+}
+
+func TestVarnishadmTargetCommandFailure(t *testing.T) {
+	cli := newFakeVarnishCLI(t, "s3cr3t\n")
+	defer cli.ln.Close()
+
+	secretFile := newTempFile(t, "secret", 0600, "s3cr3t\n")
+
+	target := newVarnishadmTarget(parseSafeURL("varnishadm://"+cli.ln.Addr().String()), secretFile, 0)
+
+	cli.setCode(106)
+	code, err := target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.Equal(t, 106, code)
+	assert.IsType(t, &backoff.PermanentError{}, err)
+
+	cli.setCode(varnishCLICant)
+	_, err = target.send(context.Background(), "random", dto.Request{Method: "PURGE", Path: "/"})
+	assert.EqualError(t, err, "varnishadm: 300")
+}
+
+func TestBanCommand(t *testing.T) {
+	_, err := banCommand(dto.Request{Method: "GET", Path: "/"})
+	assert.EqualError(t, err, `unsupported method "GET"`)
+
+	command, err := banCommand(dto.Request{Method: "BAN", Path: `/"quoted"`, Header: http.Header{}})
+	require.NoError(t, err)
+	assert.Equal(t, `ban req.url == "/\"quoted\""`, command)
+}
@@ -1,28 +1,40 @@
 package broadcaster
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/jderusse/http-broadcast/pkg/agent"
 	"github.com/jderusse/http-broadcast/pkg/config"
 	"github.com/jderusse/http-broadcast/pkg/server"
+	"github.com/jderusse/http-broadcast/pkg/tracing"
 )
 
 // Broadcaster is responsible of starting and stoping a Server and a Agent
 type Broadcaster struct {
-	agent  *agent.Agent
-	server *server.Server
-	wg     sync.WaitGroup
+	agent           *agent.Agent
+	server          *server.Server
+	shutdownTracing func(context.Context) error
+	secrets         config.SecretsOptions
+	wg              sync.WaitGroup
 }
 
 // Run starts the Server and the Agent
 func (b *Broadcaster) Run() {
 	log.Debug("Broadcaster: starting")
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if b.secrets.Store != nil && b.secrets.RefreshInterval > 0 {
+		go b.secrets.Store.Watch(ctx, b.secrets.RefreshInterval)
+	}
+
 	if b.agent != nil {
 		b.wg.Add(1) //nolint:gomnd
 
@@ -59,6 +71,10 @@ func (b *Broadcaster) Run() {
 
 	log.Debug("Broadcaster: stopped")
 	b.Stop()
+
+	if err := b.shutdownTracing(context.Background()); err != nil {
+		log.Error(err)
+	}
 }
 
 // Stop stops the Server and the Agent
@@ -87,7 +103,7 @@ func (b *Broadcaster) handleShutdown() {
 
 	go func() {
 		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
+		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 
 		<-sigint
 		log.Infoln("My Baby Shot Me Down")
@@ -102,29 +118,39 @@ func NewBroadcasterFromEnv() (*Broadcaster, error) {
 		return nil, err
 	}
 
-	return NewBroadcaster(options), nil
+	return NewBroadcaster(options)
 }
 
 // NewBroadcaster allocates and returns a new Broadcaster.
-func NewBroadcaster(options *config.Options) *Broadcaster {
+func NewBroadcaster(options *config.Options) (*Broadcaster, error) {
 	var (
-		a *agent.Agent
-		s *server.Server
+		a   *agent.Agent
+		s   *server.Server
+		err error
 	)
 
+	shutdownTracing, err := tracing.Setup(options.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
 	if options.Server.Addr != "" {
 		s = server.NewServer(options)
 	}
 
 	if nil != options.Agent.Endpoint {
-		a = agent.NewAgent(options)
+		if a, err = agent.NewAgent(options); err != nil {
+			return nil, err
+		}
 	}
 
 	b := &Broadcaster{
-		agent:  a,
-		server: s,
+		agent:           a,
+		server:          s,
+		shutdownTracing: shutdownTracing,
+		secrets:         options.Secrets,
 	}
 	b.handleShutdown()
 
-	return b
+	return b, nil
 }
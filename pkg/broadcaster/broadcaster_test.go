@@ -13,7 +13,9 @@ import (
 func TestNewBroadcaster(t *testing.T) {
 	c := &config.Options{}
 
-	NewBroadcaster(c)
+	b, err := NewBroadcaster(c)
+	assert.NotNil(t, b)
+	assert.Nil(t, err)
 }
 
 func TestNewBroadcasterFromEnv(t *testing.T) {
@@ -36,7 +38,7 @@ func TestNewHubFromEnvError(t *testing.T) {
 }
 
 func TestRun(t *testing.T) {
-	b := NewBroadcaster(&config.Options{
+	b, _ := NewBroadcaster(&config.Options{
 		Server: config.ServerOptions{
 			Addr: ":8001",
 		},
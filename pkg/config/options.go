@@ -4,29 +4,113 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
 )
 
 // Options stores the Broadcaster's options
 type Options struct {
-	Debug  bool
-	Agent  AgentOptions
-	Hub    HubOptions
-	Server ServerOptions
+	Debug   bool
+	Agent   AgentOptions
+	Hub     HubOptions
+	Server  ServerOptions
+	Tracing TracingOptions
+	Log     LogOptions
+	Secrets SecretsOptions
+}
+
+// LogOptions stores the options of the redaction of requests in logs
+type LogOptions struct {
+	RedactHeaders     []string
+	RedactBodyPattern *regexp.Regexp
+	MaxBodySize       int
+}
+
+// Tracing exporters
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// TracingOptions stores the options of the distributed tracing
+type TracingOptions struct {
+	Exporter    string
+	File        string
+	ServiceName string
+	SampleRatio float64
 }
 
+// Algorithms of the minted JWTs
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+)
+
 // ServerOptions stores the Server's options
 type ServerOptions struct {
 	Addr               string
+	AdminAddr          string
+	SocketMode         os.FileMode
+	SocketOwner        string
 	ReadTimeout        time.Duration
 	WriteTimeout       time.Duration
 	CorsAllowedOrigins []string
 	Insecure           bool
 	TrustedIPs         []string
+	MaxBodySize        int64
+	Body               BodyOptions
+	WireFormat         string
+	InvalidationPath   string
+	TransformRules     string
+	Tenants            string
 	TLS                TLSServerOptions
+	Spool              SpoolOptions
+	Status             StatusOptions
+	Audit              AuditOptions
+	Headers            HeaderPolicyOptions
+}
+
+// BodyOptions stores the options of the encoding of the broadcasted bodies
+type BodyOptions struct {
+	Encoding  string
+	Threshold int
+}
+
+// HeaderPolicyOptions stores the lists of headers allowed and denied in the
+// broadcasted requests
+type HeaderPolicyOptions struct {
+	Allow []string
+	Deny  []string
+}
+
+// SpoolOptions stores the options of the Server's spool
+type SpoolOptions struct {
+	Dir     string
+	MaxSize int
+}
+
+// StatusOptions stores the options of the Server's delivery status store
+type StatusOptions struct {
+	File     string
+	MaxSize  int
+	AgentTTL time.Duration
+}
+
+// AuditOptions stores the options of the Server's audit log
+type AuditOptions struct {
+	Output     string
+	MaxSize    int
+	MaxBackups int
+	MaxAge     int
+	Headers    bool
 }
 
 // TLSServerOptions stores the Server's TLS options
@@ -40,28 +124,133 @@ type TLSServerOptions struct {
 
 // AgentOptions stores the Agent options
 type AgentOptions struct {
-	Endpoint   *url.URL
-	RetryDelay time.Duration
+	ID                    string
+	Tenant                string
+	Endpoint              *url.URL
+	VarnishSecretFile     string
+	InvalidationTemplates string
+	ExecArgs              []string
+	ExecRetryCodes        StatusCodes
+	Script                string
+	ScriptTimeout         time.Duration
+	Retry                 RetryOptions
+	MethodRetries         map[string]RetryOptions
+	Client                ClientOptions
+	DrainTimeout          time.Duration
+	CheckpointFile        string
+	HeartbeatInterval     time.Duration
+	MaxBodySize           int64
+	Headers               HeaderPolicyOptions
 }
 
+// ClientOptions stores the options of the HTTP client used by the Agent
+type ClientOptions struct {
+	Timeout             time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	HTTP2               bool
+	UnixSocket          string
+	TLS                 TLSClientOptions
+}
+
+// TLSClientOptions stores the TLS options of the HTTP client used by the Agent
+type TLSClientOptions struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// Publish modes of the Server when several hubs are defined
+const (
+	PublishModeFailover = "failover"
+	PublishModeFanout   = "fanout"
+)
+
 // HubOptions stores the Hub options
 type HubOptions struct {
-	Endpoint       *url.URL
+	Endpoints      []*url.URL
+	PublishMode    string
 	GuardToken     string
 	PublishToken   string
 	SubscribeToken string
 	Timeout        time.Duration
 	Topic          string
+	StatusTopic    string
 	Target         string
+	JWT            JWTOptions
+}
+
+// JWTOptions stores the options of the JWTs minted to authenticate with the
+// hub
+type JWTOptions struct {
+	Algorithm string
+	Key       string
+	TTL       time.Duration
 }
 
 // NewOptionsFromEnv creates a new option instance from environment
 // It returns an error if mandatory env env vars are missing
+//
 //nolint:gocognit
 func NewOptionsFromEnv() (*Options, error) {
-	agentRetryDelay, err := time.ParseDuration(getEnv("AGENT_RETRY_DELAY", "60s"))
+	agentRetry, err := newRetryOptionsFromEnv("", RetryOptions{
+		Delay:           60 * time.Second,
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		Jitter:          0.5,
+		RetryOnError:    true,
+		RetryCodes:      StatusCodes{{Min: 400, Max: 599}},
+		SuccessCodes:    StatusCodes{{Min: 100, Max: 399}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agentMethodRetries, err := newMethodRetryOptionsFromEnv(agentRetry)
+	if err != nil {
+		return nil, err
+	}
+
+	agentTimeout, err := time.ParseDuration(getEnv("AGENT_TIMEOUT", "10s"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_TIMEOUT")
+	}
+
+	agentIdleConnTimeout, err := time.ParseDuration(getEnv("AGENT_IDLE_CONN_TIMEOUT", "90s"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_IDLE_CONN_TIMEOUT")
+	}
+
+	agentMaxIdleConns, err := strconv.Atoi(getEnv("AGENT_MAX_IDLE_CONNS", "100"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_MAX_IDLE_CONNS")
+	}
+
+	agentMaxIdleConnsPerHost, err := strconv.Atoi(getEnv("AGENT_MAX_IDLE_CONNS_PER_HOST", "10"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_MAX_IDLE_CONNS_PER_HOST")
+	}
+
+	agentDrainTimeout, err := time.ParseDuration(getEnv("AGENT_DRAIN_TIMEOUT", "30s"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_DRAIN_TIMEOUT")
+	}
+
+	agentHeartbeatInterval, err := time.ParseDuration(getEnv("AGENT_HEARTBEAT_INTERVAL", "30s"))
 	if err != nil {
-		return nil, errors.Wrap(err, "AGENT_RETRY_DELAY")
+		return nil, errors.Wrap(err, "AGENT_HEARTBEAT_INTERVAL")
+	}
+
+	agentExecRetryCodes, err := ParseExitCodes(os.Getenv("AGENT_EXEC_RETRY_CODES"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_EXEC_RETRY_CODES")
+	}
+
+	agentScriptTimeout, err := time.ParseDuration(getEnv("AGENT_SCRIPT_TIMEOUT", "1s"))
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_SCRIPT_TIMEOUT")
 	}
 
 	hubTimeout, err := time.ParseDuration(getEnv("HUB_TIMEOUT", "5s"))
@@ -69,6 +258,36 @@ func NewOptionsFromEnv() (*Options, error) {
 		return nil, errors.Wrap(err, "HUB_TIMEOUT")
 	}
 
+	hubJWTTTL, err := time.ParseDuration(getEnv("HUB_JWT_TTL", "1h"))
+	if err != nil {
+		return nil, errors.Wrap(err, "HUB_JWT_TTL")
+	}
+
+	secrets, secretsLoader, err := newSecretsOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	hubPublishToken, err := secretsLoader.get(SecretHubPublishToken, "HUB_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	hubSubscribeToken, err := secretsLoader.get(SecretHubSubscribeToken, "HUB_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	hubJWTKey, err := secretsLoader.get(SecretHubJWTKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hubJWTAlgorithm := getEnv("HUB_JWT_ALGORITHM", JWTAlgorithmHS256)
+	if hubJWTAlgorithm != JWTAlgorithmHS256 && hubJWTAlgorithm != JWTAlgorithmRS256 && hubJWTAlgorithm != JWTAlgorithmES256 {
+		return nil, fmt.Errorf(`HUB_JWT_ALGORITHM: unexpected algorithm "%s"`, hubJWTAlgorithm)
+	}
+
 	readTimeout, err := time.ParseDuration(getEnv("SERVER_READ_TIMEOUT", "0s"))
 	if err != nil {
 		return nil, errors.Wrap(err, "SERVER_READ_TIMEOUT")
@@ -79,18 +298,102 @@ func NewOptionsFromEnv() (*Options, error) {
 		return nil, errors.Wrap(err, "SERVER_WRITE_TIMEOUT")
 	}
 
+	serverSocketMode, err := parseFileMode(os.Getenv("SERVER_SOCKET_MODE"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_SOCKET_MODE")
+	}
+
+	serverSpoolMaxSize, err := strconv.Atoi(getEnv("SERVER_SPOOL_MAX_SIZE", "10000"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_SPOOL_MAX_SIZE")
+	}
+
+	serverStatusMaxSize, err := strconv.Atoi(getEnv("SERVER_STATUS_MAX_SIZE", "10000"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_STATUS_MAX_SIZE")
+	}
+
+	serverStatusAgentTTL, err := time.ParseDuration(getEnv("SERVER_STATUS_AGENT_TTL", "90s"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_STATUS_AGENT_TTL")
+	}
+
+	serverAuditLogMaxSize, err := strconv.Atoi(getEnv("SERVER_AUDIT_LOG_MAX_SIZE", "100"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_AUDIT_LOG_MAX_SIZE")
+	}
+
+	serverAuditLogMaxBackups, err := strconv.Atoi(getEnv("SERVER_AUDIT_LOG_MAX_BACKUPS", "3"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_AUDIT_LOG_MAX_BACKUPS")
+	}
+
+	serverAuditLogMaxAge, err := strconv.Atoi(getEnv("SERVER_AUDIT_LOG_MAX_AGE", "0"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_AUDIT_LOG_MAX_AGE")
+	}
+
+	tracingSampleRatio, err := strconv.ParseFloat(getEnv("TRACING_SAMPLE_RATIO", "1"), 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "TRACING_SAMPLE_RATIO")
+	}
+
+	serverMaxBodySize, err := strconv.ParseInt(getEnv("SERVER_MAX_BODY_SIZE", "1048576"), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_MAX_BODY_SIZE")
+	}
+
+	agentMaxBodySize, err := strconv.ParseInt(getEnv("AGENT_MAX_BODY_SIZE", "1048576"), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "AGENT_MAX_BODY_SIZE")
+	}
+
+	serverBodyEncoding := getEnv("SERVER_BODY_ENCODING", dto.EncodingNone)
+	if !dto.IsEncoding(serverBodyEncoding) {
+		return nil, fmt.Errorf(`SERVER_BODY_ENCODING: unexpected encoding "%s"`, serverBodyEncoding)
+	}
+
+	serverBodyEncodingThreshold, err := strconv.Atoi(getEnv("SERVER_BODY_ENCODING_THRESHOLD", "1024"))
+	if err != nil {
+		return nil, errors.Wrap(err, "SERVER_BODY_ENCODING_THRESHOLD")
+	}
+
+	serverWireFormat := getEnv("SERVER_WIRE_FORMAT", dto.FormatJSON)
+	if !dto.IsFormat(serverWireFormat) {
+		return nil, fmt.Errorf(`SERVER_WIRE_FORMAT: unexpected format "%s"`, serverWireFormat)
+	}
+
+	tracingExporter := getEnv("TRACING_EXPORTER", TracingExporterNone)
+	if tracingExporter != TracingExporterNone && tracingExporter != TracingExporterOTLP && tracingExporter != TracingExporterStdout {
+		return nil, fmt.Errorf(`TRACING_EXPORTER: unexpected exporter "%s"`, tracingExporter)
+	}
+
+	logMaxBodySize, err := strconv.Atoi(getEnv("LOG_MAX_BODY_SIZE", "1024"))
+	if err != nil {
+		return nil, errors.Wrap(err, "LOG_MAX_BODY_SIZE")
+	}
+
+	var logRedactBodyPattern *regexp.Regexp
+	if v := os.Getenv("LOG_REDACT_BODY_PATTERN"); v != "" {
+		if logRedactBodyPattern, err = regexp.Compile(v); err != nil {
+			return nil, errors.Wrap(err, "LOG_REDACT_BODY_PATTERN")
+		}
+	}
+
+	hostname, _ := os.Hostname()
+
 	agentEndpoint, err := parseURL(os.Getenv("AGENT_ENDPOINT"))
 	if err != nil {
 		return nil, errors.Wrap(err, "AGENT_ENDPOINT")
 	}
 
-	hubEndpoint, err := parseURL(os.Getenv("HUB_ENDPOINT"))
+	hubEndpoints, err := parseURLs(os.Getenv("HUB_ENDPOINT"))
 	if err != nil {
 		return nil, errors.Wrap(err, "HUB_ENDPOINT")
 	}
 
 	hubTopic := os.Getenv("HUB_TOPIC")
-	if hubEndpoint != nil {
+	for _, hubEndpoint := range hubEndpoints {
 		if hubTopic == "" {
 			hubTopic = hubEndpoint.Query().Get("topic")
 		}
@@ -105,7 +408,7 @@ func NewOptionsFromEnv() (*Options, error) {
 	}
 
 	hubTarget := os.Getenv("HUB_TARGET")
-	if hubEndpoint != nil {
+	for _, hubEndpoint := range hubEndpoints {
 		if hubTarget == "" {
 			hubTarget = hubEndpoint.Query().Get("target")
 		}
@@ -115,28 +418,83 @@ func NewOptionsFromEnv() (*Options, error) {
 		hubEndpoint.RawQuery = q.Encode()
 	}
 
+	hubPublishMode := getEnv("HUB_PUBLISH_MODE", PublishModeFailover)
+	if hubPublishMode != PublishModeFailover && hubPublishMode != PublishModeFanout {
+		return nil, fmt.Errorf(`HUB_PUBLISH_MODE: unexpected mode "%s"`, hubPublishMode)
+	}
+
 	options := &Options{
 		Debug: getEnv("DEBUG", "0") == "1",
 		Agent: AgentOptions{
-			Endpoint:   agentEndpoint,
-			RetryDelay: agentRetryDelay,
+			ID:            getEnv("AGENT_ID", hostname),
+			Tenant:        os.Getenv("AGENT_TENANT"),
+			Endpoint:      agentEndpoint,
+			Retry:         agentRetry,
+			MethodRetries: agentMethodRetries,
+			Client: ClientOptions{
+				Timeout:             agentTimeout,
+				MaxIdleConns:        agentMaxIdleConns,
+				MaxIdleConnsPerHost: agentMaxIdleConnsPerHost,
+				IdleConnTimeout:     agentIdleConnTimeout,
+				HTTP2:               getEnv("AGENT_HTTP2", "1") == "1",
+				UnixSocket:          os.Getenv("AGENT_UNIX_SOCKET"),
+				TLS: TLSClientOptions{
+					CAFile:             os.Getenv("AGENT_TLS_CA_FILE"),
+					CertFile:           os.Getenv("AGENT_TLS_CERT_FILE"),
+					KeyFile:            os.Getenv("AGENT_TLS_KEY_FILE"),
+					InsecureSkipVerify: getEnv("AGENT_TLS_INSECURE_SKIP_VERIFY", "0") == "1",
+				},
+			},
+			DrainTimeout:          agentDrainTimeout,
+			CheckpointFile:        os.Getenv("AGENT_CHECKPOINT_FILE"),
+			VarnishSecretFile:     os.Getenv("AGENT_VARNISH_SECRET_FILE"),
+			InvalidationTemplates: os.Getenv("AGENT_INVALIDATION_TEMPLATES"),
+			ExecArgs:              splitVar(os.Getenv("AGENT_EXEC_ARGS")),
+			ExecRetryCodes:        agentExecRetryCodes,
+			Script:                os.Getenv("AGENT_SCRIPT"),
+			ScriptTimeout:         agentScriptTimeout,
+			HeartbeatInterval:     agentHeartbeatInterval,
+			MaxBodySize:           agentMaxBodySize,
+			Headers: HeaderPolicyOptions{
+				Allow: splitVar(os.Getenv("AGENT_HEADERS_ALLOW")),
+				Deny:  splitVar(os.Getenv("AGENT_HEADERS_DENY")),
+			},
 		},
 		Hub: HubOptions{
-			Endpoint:       hubEndpoint,
+			Endpoints:      hubEndpoints,
+			PublishMode:    hubPublishMode,
 			GuardToken:     getEnv("HUB_GUARD_TOKEN", hubTopic),
-			PublishToken:   getEnv("HUB_PUBLISH_TOKEN", os.Getenv("HUB_TOKEN")),
-			SubscribeToken: getEnv("HUB_SUBSCRIBE_TOKEN", os.Getenv("HUB_TOKEN")),
+			PublishToken:   hubPublishToken,
+			SubscribeToken: hubSubscribeToken,
 			Timeout:        hubTimeout,
 			Topic:          hubTopic,
+			StatusTopic:    os.Getenv("HUB_STATUS_TOPIC"),
 			Target:         hubTarget,
+			JWT: JWTOptions{
+				Algorithm: hubJWTAlgorithm,
+				Key:       hubJWTKey,
+				TTL:       hubJWTTTL,
+			},
 		},
 		Server: ServerOptions{
 			Addr:               os.Getenv("SERVER_ADDR"),
+			AdminAddr:          os.Getenv("SERVER_ADMIN_ADDR"),
+			SocketMode:         serverSocketMode,
+			SocketOwner:        os.Getenv("SERVER_SOCKET_OWNER"),
 			ReadTimeout:        readTimeout,
 			WriteTimeout:       writeTimeout,
 			CorsAllowedOrigins: splitVar(os.Getenv("SERVER_CORS_ALLOWED_ORIGINS")),
 			Insecure:           getEnv("SERVER_INSECURE", getEnv("DEBUG", "0")) == "1",
 			TrustedIPs:         splitVar(os.Getenv("SERVER_TRUSTED_IPS")),
+			MaxBodySize:        serverMaxBodySize,
+			Body: BodyOptions{
+				Encoding:  serverBodyEncoding,
+				Threshold: serverBodyEncodingThreshold,
+			},
+			WireFormat:       serverWireFormat,
+			InvalidationPath: os.Getenv("SERVER_INVALIDATION_PATH"),
+			TransformRules:   os.Getenv("SERVER_TRANSFORM_RULES"),
+			Tenants:          os.Getenv("SERVER_TENANTS"),
 			TLS: TLSServerOptions{
 				AcmeAddr:    getEnv("SERVER_TLS_ACME_ADDR", ":http"),
 				AcmeCertDir: os.Getenv("SERVER_TLS_ACME_CERT_DIR"),
@@ -144,11 +502,43 @@ func NewOptionsFromEnv() (*Options, error) {
 				CertFile:    os.Getenv("SERVER_TLS_CERT_FILE"),
 				KeyFile:     os.Getenv("SERVER_TLS_KEY_FILE"),
 			},
+			Spool: SpoolOptions{
+				Dir:     os.Getenv("SERVER_SPOOL_DIR"),
+				MaxSize: serverSpoolMaxSize,
+			},
+			Status: StatusOptions{
+				File:     os.Getenv("SERVER_STATUS_FILE"),
+				MaxSize:  serverStatusMaxSize,
+				AgentTTL: serverStatusAgentTTL,
+			},
+			Audit: AuditOptions{
+				Output:     os.Getenv("SERVER_AUDIT_LOG"),
+				MaxSize:    serverAuditLogMaxSize,
+				MaxBackups: serverAuditLogMaxBackups,
+				MaxAge:     serverAuditLogMaxAge,
+				Headers:    getEnv("SERVER_AUDIT_LOG_HEADERS", "0") == "1",
+			},
+			Headers: HeaderPolicyOptions{
+				Allow: splitVar(os.Getenv("SERVER_HEADERS_ALLOW")),
+				Deny:  splitVar(getEnv("SERVER_HEADERS_DENY", "Authorization,Cookie,Forwarded,X-Forwarded-*")),
+			},
+		},
+		Log: LogOptions{
+			RedactHeaders:     splitVar(getEnv("LOG_REDACT_HEADERS", "Authorization,Proxy-Authorization,Cookie,Set-Cookie")),
+			RedactBodyPattern: logRedactBodyPattern,
+			MaxBodySize:       logMaxBodySize,
+		},
+		Tracing: TracingOptions{
+			Exporter:    tracingExporter,
+			File:        os.Getenv("TRACING_FILE"),
+			ServiceName: getEnv("TRACING_SERVICE_NAME", "http-broadcast"),
+			SampleRatio: tracingSampleRatio,
 		},
+		Secrets: secrets,
 	}
 
 	var missingEnv []string
-	if options.Hub.Endpoint == nil {
+	if len(options.Hub.Endpoints) == 0 {
 		missingEnv = append(missingEnv, "HUB_ENDPOINT")
 	}
 
@@ -160,7 +550,11 @@ func NewOptionsFromEnv() (*Options, error) {
 		missingEnv = append(missingEnv, "SERVER_ADDR/AGENT_ENDPOINT")
 	}
 
-	if len(options.Server.Addr) != 0 && len(options.Hub.PublishToken) == 0 {
+	if len(options.Server.Addr) != 0 && len(options.Hub.PublishToken) == 0 && len(options.Hub.JWT.Key) == 0 {
+		missingEnv = append(missingEnv, "HUB_PUBLISH_TOKEN/HUB_TOKEN")
+	}
+
+	if options.Agent.Endpoint != nil && len(options.Hub.StatusTopic) != 0 && len(options.Hub.PublishToken) == 0 && len(options.Hub.JWT.Key) == 0 {
 		missingEnv = append(missingEnv, "HUB_PUBLISH_TOKEN/HUB_TOKEN")
 	}
 
@@ -172,6 +566,14 @@ func NewOptionsFromEnv() (*Options, error) {
 		missingEnv = append(missingEnv, "SERVER_TLS_CERT_FILE")
 	}
 
+	if len(options.Agent.Client.TLS.CertFile) != 0 && len(options.Agent.Client.TLS.KeyFile) == 0 {
+		missingEnv = append(missingEnv, "AGENT_TLS_KEY_FILE")
+	}
+
+	if len(options.Agent.Client.TLS.KeyFile) != 0 && len(options.Agent.Client.TLS.CertFile) == 0 {
+		missingEnv = append(missingEnv, "AGENT_TLS_CERT_FILE")
+	}
+
 	if len(missingEnv) > 0 {
 		return nil, fmt.Errorf("the following environment variable must be defined: %s", missingEnv)
 	}
@@ -196,6 +598,23 @@ func splitVar(v string) []string {
 	return strings.Split(v, ",")
 }
 
+func parseURLs(v string) ([]*url.URL, error) {
+	var urls []*url.URL
+
+	for _, elem := range splitVar(v) {
+		u, err := parseURL(strings.TrimSpace(elem))
+		if err != nil {
+			return nil, err
+		}
+
+		if u != nil {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls, nil
+}
+
 func parseURL(v string) (*url.URL, error) {
 	if v == "" {
 		return nil, nil
@@ -203,3 +622,16 @@ func parseURL(v string) (*url.URL, error) {
 
 	return url.Parse(v)
 }
+
+func parseFileMode(v string) (os.FileMode, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	m, err := strconv.ParseUint(v, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return os.FileMode(m), nil
+}
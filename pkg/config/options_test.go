@@ -3,6 +3,7 @@ package config
 import (
 	"net/url"
 	"os"
+	"regexp"
 	"testing"
 	"time"
 
@@ -12,30 +13,92 @@ import (
 
 func TestNewOptionsFormNew(t *testing.T) {
 	testEnv := map[string]string{
-		"AGENT_ENDPOINT":              "http://agent/",
-		"AGENT_RETRY_DELAY":           "1m",
-		"DEBUG":                       "1",
-		"HUB_ENDPOINT":                "http://hub/",
-		"HUB_GUARD_TOKEN":             "guard_token",
-		"HUB_PUBLISH_TOKEN":           "pub_token",
-		"HUB_SUBSCRIBE_TOKEN":         "sub_token",
-		"HUB_TIMEOUT":                 "1m",
-		"HUB_TOKEN":                   "token",
-		"HUB_TOPIC":                   "my_topic",
-		"HUB_TARGET":                  "my_target",
-		"LOG_FORMAT":                  "json",
-		"LOG_LEVEL":                   "warn",
-		"SERVER_ADDR":                 "0.0.0.0:81",
-		"SERVER_CORS_ALLOWED_ORIGINS": "example.com,bar.com",
-		"SERVER_INSECURE":             "1",
-		"SERVER_READ_TIMEOUT":         "1m",
-		"SERVER_TLS_ACME_ADDR":        ":81",
-		"SERVER_TLS_ACME_CERT_DIR":    "/tmp",
-		"SERVER_TLS_ACME_HOSTS":       "example.com",
-		"SERVER_TLS_CERT_FILE":        "/tmp/cert",
-		"SERVER_TLS_KEY_FILE":         "/tmp/key",
-		"SERVER_TRUSTED_IPS":          "127.0.0.1,1.2.3.4",
-		"SERVER_WRITE_TIMEOUT":        "1m",
+		"AGENT_ENDPOINT":                 "http://agent/",
+		"AGENT_RETRY_DELAY":              "1m",
+		"AGENT_RETRY_MAX_ATTEMPTS":       "5",
+		"AGENT_RETRY_SUCCESS_CODES":      "2xx",
+		"AGENT_RETRY_CODES":              "5xx,429",
+		"AGENT_RETRY_CODES_PURGE":        "5xx",
+		"AGENT_TIMEOUT":                  "1m",
+		"AGENT_IDLE_CONN_TIMEOUT":        "1m",
+		"AGENT_MAX_IDLE_CONNS":           "50",
+		"AGENT_MAX_IDLE_CONNS_PER_HOST":  "5",
+		"AGENT_HTTP2":                    "0",
+		"AGENT_UNIX_SOCKET":              "/tmp/agent.sock",
+		"AGENT_TLS_CA_FILE":              "/tmp/ca",
+		"AGENT_TLS_CERT_FILE":            "/tmp/agent-cert",
+		"AGENT_TLS_KEY_FILE":             "/tmp/agent-key",
+		"AGENT_TLS_INSECURE_SKIP_VERIFY": "1",
+		"AGENT_DRAIN_TIMEOUT":            "1m",
+		"AGENT_CHECKPOINT_FILE":          "/tmp/checkpoint",
+		"AGENT_VARNISH_SECRET_FILE":      "/etc/varnish/secret",
+		"AGENT_INVALIDATION_TEMPLATES":   "/etc/http-broadcast/templates.json",
+		"AGENT_EXEC_ARGS":                "--all,--verbose",
+		"AGENT_EXEC_RETRY_CODES":         "75,64-70",
+		"AGENT_SCRIPT":                   "/etc/http-broadcast/replay.star",
+		"AGENT_SCRIPT_TIMEOUT":           "50ms",
+		"AGENT_HEARTBEAT_INTERVAL":       "1m",
+		"AGENT_MAX_BODY_SIZE":            "4096",
+		"AGENT_ID":                       "agent-1",
+		"AGENT_TENANT":                   "brand-a",
+		"AGENT_HEADERS_ALLOW":            "X-Purge-*,Host",
+		"AGENT_HEADERS_DENY":             "X-Purge-Debug",
+		"DEBUG":                          "1",
+		"HUB_ENDPOINT":                   "http://hub/",
+		"HUB_GUARD_TOKEN":                "guard_token",
+		"HUB_PUBLISH_TOKEN":              "pub_token",
+		"HUB_SUBSCRIBE_TOKEN":            "sub_token",
+		"HUB_TIMEOUT":                    "1m",
+		"HUB_JWT_ALGORITHM":              "ES256",
+		"HUB_JWT_KEY":                    "key",
+		"HUB_JWT_TTL":                    "10m",
+		"HUB_TOKEN":                      "token",
+		"HUB_TOPIC":                      "my_topic",
+		"HUB_TARGET":                     "my_target",
+		"HUB_STATUS_TOPIC":               "my_status_topic",
+		"LOG_FORMAT":                     "json",
+		"LOG_LEVEL":                      "warn",
+		"LOG_REDACT_HEADERS":             "Authorization,X-Api-Key",
+		"LOG_REDACT_BODY_PATTERN":        "password=[^&]*",
+		"LOG_MAX_BODY_SIZE":              "100",
+		"SERVER_ADMIN_ADDR":              ":9090",
+		"SERVER_AUDIT_LOG":               "/tmp/audit.log",
+		"SERVER_AUDIT_LOG_MAX_SIZE":      "10",
+		"SERVER_AUDIT_LOG_MAX_BACKUPS":   "5",
+		"SERVER_AUDIT_LOG_MAX_AGE":       "7",
+		"SERVER_AUDIT_LOG_HEADERS":       "1",
+		"SERVER_BODY_ENCODING":           "zstd",
+		"SERVER_BODY_ENCODING_THRESHOLD": "512",
+		"SERVER_MAX_BODY_SIZE":           "2048",
+		"SERVER_WIRE_FORMAT":             "msgpack",
+		"SERVER_INVALIDATION_PATH":       "/invalidate",
+		"SERVER_TRANSFORM_RULES":         "/etc/http-broadcast/transform.json",
+		"SERVER_TENANTS":                 "/etc/http-broadcast/tenants.json",
+		"SERVER_SPOOL_DIR":               "/tmp/spool",
+		"SERVER_SPOOL_MAX_SIZE":          "100",
+		"SERVER_STATUS_FILE":             "/tmp/status",
+		"SERVER_STATUS_MAX_SIZE":         "100",
+		"SERVER_STATUS_AGENT_TTL":        "1m",
+		"SERVER_ADDR":                    "0.0.0.0:81",
+		"SERVER_CORS_ALLOWED_ORIGINS":    "example.com,bar.com",
+		"SERVER_HEADERS_ALLOW":           "X-Purge-*",
+		"SERVER_HEADERS_DENY":            "Cookie,X-Forwarded-*",
+		"SERVER_INSECURE":                "1",
+		"SERVER_READ_TIMEOUT":            "1m",
+		"SERVER_SOCKET_MODE":             "0660",
+		"SERVER_SOCKET_OWNER":            "www-data:varnish",
+		"SERVER_TLS_ACME_ADDR":           ":81",
+		"SERVER_TLS_ACME_CERT_DIR":       "/tmp",
+		"SERVER_TLS_ACME_HOSTS":          "example.com",
+		"SERVER_TLS_CERT_FILE":           "/tmp/cert",
+		"SERVER_TLS_KEY_FILE":            "/tmp/key",
+		"SERVER_TRUSTED_IPS":             "127.0.0.1,1.2.3.4",
+		"SERVER_WRITE_TIMEOUT":           "1m",
+		"SECRETS_REFRESH_INTERVAL":       "30s",
+		"TRACING_EXPORTER":               "stdout",
+		"TRACING_FILE":                   "/tmp/traces",
+		"TRACING_SERVICE_NAME":           "my_service",
+		"TRACING_SAMPLE_RATIO":           "0.5",
 	}
 	for k, v := range testEnv {
 		os.Setenv(k, v)
@@ -43,28 +106,99 @@ func TestNewOptionsFormNew(t *testing.T) {
 	}
 
 	opts, err := NewOptionsFromEnv()
+	require.NoError(t, err)
 	assert.Equal(t, &Options{
 		Debug: true,
 		Agent: AgentOptions{
-			Endpoint:   parseSafeURL("http://agent/"),
-			RetryDelay: 1 * time.Minute,
+			ID:       "agent-1",
+			Tenant:   "brand-a",
+			Endpoint: parseSafeURL("http://agent/"),
+			Retry: RetryOptions{
+				Delay:           1 * time.Minute,
+				MaxAttempts:     5,
+				InitialInterval: 500 * time.Millisecond,
+				MaxInterval:     5 * time.Second,
+				Jitter:          0.5,
+				RetryOnError:    true,
+				RetryCodes:      StatusCodes{{500, 599}, {429, 429}},
+				SuccessCodes:    StatusCodes{{200, 299}},
+			},
+			MethodRetries: map[string]RetryOptions{
+				"PURGE": {
+					Delay:           1 * time.Minute,
+					MaxAttempts:     5,
+					InitialInterval: 500 * time.Millisecond,
+					MaxInterval:     5 * time.Second,
+					Jitter:          0.5,
+					RetryOnError:    true,
+					RetryCodes:      StatusCodes{{500, 599}},
+					SuccessCodes:    StatusCodes{{200, 299}},
+				},
+			},
+			Client: ClientOptions{
+				Timeout:             1 * time.Minute,
+				MaxIdleConns:        50,
+				MaxIdleConnsPerHost: 5,
+				IdleConnTimeout:     1 * time.Minute,
+				HTTP2:               false,
+				UnixSocket:          "/tmp/agent.sock",
+				TLS: TLSClientOptions{
+					CAFile:             "/tmp/ca",
+					CertFile:           "/tmp/agent-cert",
+					KeyFile:            "/tmp/agent-key",
+					InsecureSkipVerify: true,
+				},
+			},
+			DrainTimeout:          1 * time.Minute,
+			CheckpointFile:        "/tmp/checkpoint",
+			VarnishSecretFile:     "/etc/varnish/secret",
+			InvalidationTemplates: "/etc/http-broadcast/templates.json",
+			ExecArgs:              []string{"--all", "--verbose"},
+			ExecRetryCodes:        StatusCodes{{75, 75}, {64, 70}},
+			Script:                "/etc/http-broadcast/replay.star",
+			ScriptTimeout:         50 * time.Millisecond,
+			HeartbeatInterval:     1 * time.Minute,
+			MaxBodySize:           4096,
+			Headers: HeaderPolicyOptions{
+				Allow: []string{"X-Purge-*", "Host"},
+				Deny:  []string{"X-Purge-Debug"},
+			},
 		},
 		Hub: HubOptions{
-			Endpoint:       parseSafeURL("http://hub/"),
+			Endpoints:      []*url.URL{parseSafeURL("http://hub/")},
+			PublishMode:    PublishModeFailover,
 			GuardToken:     "guard_token",
 			PublishToken:   "pub_token",
 			SubscribeToken: "sub_token",
 			Timeout:        1 * time.Minute,
 			Topic:          "my_topic",
+			StatusTopic:    "my_status_topic",
 			Target:         "my_target",
+			JWT: JWTOptions{
+				Algorithm: "ES256",
+				Key:       "key",
+				TTL:       10 * time.Minute,
+			},
 		},
 		Server: ServerOptions{
 			Addr:               "0.0.0.0:81",
+			AdminAddr:          ":9090",
+			SocketMode:         0660,
+			SocketOwner:        "www-data:varnish",
 			ReadTimeout:        1 * time.Minute,
 			WriteTimeout:       1 * time.Minute,
 			CorsAllowedOrigins: []string{"example.com", "bar.com"},
 			Insecure:           true,
 			TrustedIPs:         []string{"127.0.0.1", "1.2.3.4"},
+			MaxBodySize:        2048,
+			Body: BodyOptions{
+				Encoding:  "zstd",
+				Threshold: 512,
+			},
+			WireFormat:       "msgpack",
+			InvalidationPath: "/invalidate",
+			TransformRules:   "/etc/http-broadcast/transform.json",
+			Tenants:          "/etc/http-broadcast/tenants.json",
 			TLS: TLSServerOptions{
 				AcmeAddr:    ":81",
 				AcmeCertDir: "/tmp",
@@ -72,6 +206,41 @@ func TestNewOptionsFormNew(t *testing.T) {
 				CertFile:    "/tmp/cert",
 				KeyFile:     "/tmp/key",
 			},
+			Spool: SpoolOptions{
+				Dir:     "/tmp/spool",
+				MaxSize: 100,
+			},
+			Status: StatusOptions{
+				File:     "/tmp/status",
+				MaxSize:  100,
+				AgentTTL: 1 * time.Minute,
+			},
+			Audit: AuditOptions{
+				Output:     "/tmp/audit.log",
+				MaxSize:    10,
+				MaxBackups: 5,
+				MaxAge:     7,
+				Headers:    true,
+			},
+			Headers: HeaderPolicyOptions{
+				Allow: []string{"X-Purge-*"},
+				Deny:  []string{"Cookie", "X-Forwarded-*"},
+			},
+		},
+		Log: LogOptions{
+			RedactHeaders:     []string{"Authorization", "X-Api-Key"},
+			RedactBodyPattern: regexp.MustCompile("password=[^&]*"),
+			MaxBodySize:       100,
+		},
+		Tracing: TracingOptions{
+			Exporter:    TracingExporterStdout,
+			File:        "/tmp/traces",
+			ServiceName: "my_service",
+			SampleRatio: 0.5,
+		},
+		Secrets: SecretsOptions{
+			RefreshInterval: 30 * time.Second,
+			Store:           opts.Secrets.Store,
 		},
 	}, opts)
 	assert.Nil(t, err)
@@ -98,6 +267,88 @@ func TestMissingCertFile(t *testing.T) {
 	assert.EqualError(t, err, "the following environment variable must be defined: [HUB_ENDPOINT SERVER_ADDR/AGENT_ENDPOINT SERVER_TLS_CERT_FILE]")
 }
 
+func TestMissingAgentKeyFile(t *testing.T) {
+	os.Setenv("AGENT_TLS_CERT_FILE", "foo")
+	defer os.Unsetenv("AGENT_TLS_CERT_FILE")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, "the following environment variable must be defined: [HUB_ENDPOINT SERVER_ADDR/AGENT_ENDPOINT AGENT_TLS_KEY_FILE]")
+}
+
+func TestMissingAgentCertFile(t *testing.T) {
+	os.Setenv("AGENT_TLS_KEY_FILE", "foo")
+	defer os.Unsetenv("AGENT_TLS_KEY_FILE")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, "the following environment variable must be defined: [HUB_ENDPOINT SERVER_ADDR/AGENT_ENDPOINT AGENT_TLS_CERT_FILE]")
+}
+
+func TestMissingAgentPublishToken(t *testing.T) {
+	os.Setenv("AGENT_ENDPOINT", "http://agent/")
+	os.Setenv("HUB_ENDPOINT", "http://hub/")
+	os.Setenv("HUB_STATUS_TOPIC", "status")
+	defer os.Unsetenv("AGENT_ENDPOINT")
+	defer os.Unsetenv("HUB_ENDPOINT")
+	defer os.Unsetenv("HUB_STATUS_TOPIC")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, "the following environment variable must be defined: [HUB_PUBLISH_TOKEN/HUB_TOKEN]")
+
+	os.Setenv("HUB_JWT_KEY", "key")
+	defer os.Unsetenv("HUB_JWT_KEY")
+
+	_, err = NewOptionsFromEnv()
+	assert.NoError(t, err)
+}
+
+func TestInvalidTracingExporter(t *testing.T) {
+	os.Setenv("TRACING_EXPORTER", "foo")
+	defer os.Unsetenv("TRACING_EXPORTER")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `TRACING_EXPORTER: unexpected exporter "foo"`)
+}
+
+func TestInvalidBodyEncoding(t *testing.T) {
+	os.Setenv("SERVER_BODY_ENCODING", "br")
+	defer os.Unsetenv("SERVER_BODY_ENCODING")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `SERVER_BODY_ENCODING: unexpected encoding "br"`)
+}
+
+func TestInvalidJWTAlgorithm(t *testing.T) {
+	os.Setenv("HUB_JWT_ALGORITHM", "none")
+	defer os.Unsetenv("HUB_JWT_ALGORITHM")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `HUB_JWT_ALGORITHM: unexpected algorithm "none"`)
+}
+
+func TestInvalidWireFormat(t *testing.T) {
+	os.Setenv("SERVER_WIRE_FORMAT", "protobuf")
+	defer os.Unsetenv("SERVER_WIRE_FORMAT")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `SERVER_WIRE_FORMAT: unexpected format "protobuf"`)
+}
+
+func TestInvalidRedactBodyPattern(t *testing.T) {
+	os.Setenv("LOG_REDACT_BODY_PATTERN", "(")
+	defer os.Unsetenv("LOG_REDACT_BODY_PATTERN")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, "LOG_REDACT_BODY_PATTERN: error parsing regexp: missing closing ): `(`")
+}
+
+func TestInvalidSocketMode(t *testing.T) {
+	os.Setenv("SERVER_SOCKET_MODE", "0999")
+	defer os.Unsetenv("SERVER_SOCKET_MODE")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `SERVER_SOCKET_MODE: strconv.ParseUint: parsing "0999": invalid syntax`)
+}
+
 func TestInvalidDuration(t *testing.T) {
 	vars := []string{"AGENT_RETRY_DELAY", "HUB_TIMEOUT", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT"}
 	for _, elem := range vars {
@@ -127,6 +378,42 @@ func parseSafeURL(urlString string) *url.URL {
 	return u
 }
 
+func TestMultipleHubs(t *testing.T) {
+	os.Setenv("SERVER_ADDR", ":http")
+	os.Setenv("HUB_TOKEN", "token")
+	os.Setenv("HUB_ENDPOINT", "http://hub1/?topic=foo, http://hub2/")
+	os.Setenv("HUB_PUBLISH_MODE", "fanout")
+	defer os.Unsetenv("SERVER_ADDR")
+	defer os.Unsetenv("HUB_TOKEN")
+	defer os.Unsetenv("HUB_ENDPOINT")
+	defer os.Unsetenv("HUB_PUBLISH_MODE")
+
+	opts, err := NewOptionsFromEnv()
+	require.Nil(t, err)
+	assert.Equal(t, []*url.URL{parseSafeURL("http://hub1/"), parseSafeURL("http://hub2/")}, opts.Hub.Endpoints)
+	assert.Equal(t, "foo", opts.Hub.Topic)
+	assert.Equal(t, PublishModeFanout, opts.Hub.PublishMode)
+
+	os.Setenv("HUB_PUBLISH_MODE", "foo")
+
+	_, err = NewOptionsFromEnv()
+	assert.EqualError(t, err, `HUB_PUBLISH_MODE: unexpected mode "foo"`)
+}
+
+func TestDefaultHeaderPolicy(t *testing.T) {
+	os.Setenv("SERVER_ADDR", ":http")
+	os.Setenv("HUB_TOKEN", "token")
+	os.Setenv("HUB_ENDPOINT", "http://hub/")
+	defer os.Unsetenv("SERVER_ADDR")
+	defer os.Unsetenv("HUB_TOKEN")
+	defer os.Unsetenv("HUB_ENDPOINT")
+
+	opts, err := NewOptionsFromEnv()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"Authorization", "Cookie", "Forwarded", "X-Forwarded-*"}, opts.Server.Headers.Deny)
+	assert.Empty(t, opts.Agent.Headers.Deny)
+}
+
 func TestFallbackHub(t *testing.T) {
 	var providerTests = []struct {
 		endpoint         string
@@ -151,7 +438,7 @@ func TestFallbackHub(t *testing.T) {
 
 		opts, err := NewOptionsFromEnv()
 		require.Nil(t, err)
-		assert.Equal(t, parseSafeURL(test.expectedEndpoint), opts.Hub.Endpoint)
+		assert.Equal(t, []*url.URL{parseSafeURL(test.expectedEndpoint)}, opts.Hub.Endpoints)
 		assert.Equal(t, test.expectedTopic, opts.Hub.Topic)
 	}
 }
@@ -0,0 +1,289 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const retryEnvPrefix = "AGENT_RETRY_"
+
+// RetryOptions stores the policy used by the Agent to retry a request
+type RetryOptions struct {
+	Delay           time.Duration
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Jitter          float64
+	RetryOnError    bool
+	RetryCodes      StatusCodes
+	SuccessCodes    StatusCodes
+}
+
+// StatusCodeRange is an inclusive range of HTTP status codes
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+// StatusCodes is a list of HTTP status code ranges. It also stores ranges of
+// exit codes for the commands run by `exec:` endpoints.
+type StatusCodes []StatusCodeRange
+
+// Contains returns whether the given code belongs to one of the ranges.
+func (s StatusCodes) Contains(code int) bool {
+	for _, r := range s {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseStatusCodes parses a comma separated list of status codes.
+// Each element could be a single code (`404`), a class of codes (`5xx`) or
+// an inclusive range (`500-504`).
+func ParseStatusCodes(v string) (StatusCodes, error) {
+	codes := StatusCodes{}
+
+	for _, elem := range splitVar(v) {
+		elem = strings.ToLower(strings.TrimSpace(elem))
+		if elem == "" {
+			continue
+		}
+
+		r, err := parseStatusCodeRange(elem)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, r)
+	}
+
+	return codes, nil
+}
+
+func parseStatusCodeRange(v string) (StatusCodeRange, error) {
+	if len(v) == 3 && strings.HasSuffix(v, "xx") {
+		class, err := strconv.Atoi(v[:1])
+		if err != nil || class < 1 || class > 5 {
+			return StatusCodeRange{}, fmt.Errorf(`invalid status code class "%s"`, v)
+		}
+
+		return StatusCodeRange{Min: class * 100, Max: class*100 + 99}, nil
+	}
+
+	return parseCodeRange(v, "status code", parseStatusCode)
+}
+
+// ParseExitCodes parses a comma separated list of exit codes. Each element
+// could be a single code (`75`) or an inclusive range (`64-78`).
+func ParseExitCodes(v string) (StatusCodes, error) {
+	codes := StatusCodes{}
+
+	for _, elem := range splitVar(v) {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+
+		r, err := parseCodeRange(elem, "exit code", parseExitCode)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, r)
+	}
+
+	return codes, nil
+}
+
+func parseCodeRange(v string, kind string, parse func(string) (int, error)) (StatusCodeRange, error) {
+	bounds := strings.SplitN(v, "-", 2)
+
+	min, err := parse(bounds[0])
+	if err != nil {
+		return StatusCodeRange{}, err
+	}
+
+	max := min
+
+	if len(bounds) == 2 {
+		if max, err = parse(bounds[1]); err != nil {
+			return StatusCodeRange{}, err
+		}
+	}
+
+	if max < min {
+		return StatusCodeRange{}, fmt.Errorf(`invalid %s range "%s"`, kind, v)
+	}
+
+	return StatusCodeRange{Min: min, Max: max}, nil
+}
+
+func parseStatusCode(v string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf(`invalid status code "%s"`, v)
+	}
+
+	return code, nil
+}
+
+func parseExitCode(v string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || code < 1 || code > 255 {
+		return 0, fmt.Errorf(`invalid exit code "%s"`, v)
+	}
+
+	return code, nil
+}
+
+// newRetryOptionsFromEnv reads the retry policy from the AGENT_RETRY_* env
+// vars suffixed by the given suffix. Undefined vars fall back on defaults.
+func newRetryOptionsFromEnv(suffix string, defaults RetryOptions) (RetryOptions, error) {
+	options := defaults
+
+	if err := lookupDuration(retryEnvPrefix+"DELAY"+suffix, &options.Delay); err != nil {
+		return options, err
+	}
+
+	if err := lookupInt(retryEnvPrefix+"MAX_ATTEMPTS"+suffix, &options.MaxAttempts); err != nil {
+		return options, err
+	}
+
+	if options.MaxAttempts < 0 {
+		return options, fmt.Errorf(`%s: unexpected number of attempts "%d"`, retryEnvPrefix+"MAX_ATTEMPTS"+suffix, options.MaxAttempts)
+	}
+
+	if err := lookupDuration(retryEnvPrefix+"INITIAL_INTERVAL"+suffix, &options.InitialInterval); err != nil {
+		return options, err
+	}
+
+	if err := lookupDuration(retryEnvPrefix+"MAX_INTERVAL"+suffix, &options.MaxInterval); err != nil {
+		return options, err
+	}
+
+	if err := lookupFloat(retryEnvPrefix+"JITTER"+suffix, &options.Jitter); err != nil {
+		return options, err
+	}
+
+	if options.Jitter < 0 || options.Jitter > 1 {
+		return options, fmt.Errorf(`%s: unexpected factor "%g", expected a value between 0 and 1`, retryEnvPrefix+"JITTER"+suffix, options.Jitter)
+	}
+
+	if v := os.Getenv(retryEnvPrefix + "ON_ERROR" + suffix); v != "" {
+		options.RetryOnError = v == "1"
+	}
+
+	if err := lookupStatusCodes(retryEnvPrefix+"CODES"+suffix, &options.RetryCodes); err != nil {
+		return options, err
+	}
+
+	if err := lookupStatusCodes(retryEnvPrefix+"SUCCESS_CODES"+suffix, &options.SuccessCodes); err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+// newMethodRetryOptionsFromEnv reads the per method overrides of the retry
+// policy. Overrides are defined by suffixing the AGENT_RETRY_* env vars by
+// the name of the method, ie. `AGENT_RETRY_SUCCESS_CODES_PURGE=2xx,404`.
+func newMethodRetryOptionsFromEnv(defaults RetryOptions) (map[string]RetryOptions, error) {
+	settings := []string{"DELAY", "MAX_ATTEMPTS", "INITIAL_INTERVAL", "MAX_INTERVAL", "JITTER", "ON_ERROR", "CODES", "SUCCESS_CODES"}
+	methods := map[string]RetryOptions{}
+
+	for _, env := range os.Environ() {
+		k := strings.SplitN(env, "=", 2)[0]
+		for _, setting := range settings {
+			prefix := retryEnvPrefix + setting + "_"
+			if !strings.HasPrefix(k, prefix) || len(k) == len(prefix) {
+				continue
+			}
+
+			method := k[len(prefix):]
+			if _, ok := methods[method]; ok {
+				continue
+			}
+
+			options, err := newRetryOptionsFromEnv("_"+method, defaults)
+			if err != nil {
+				return nil, err
+			}
+
+			methods[method] = options
+		}
+	}
+
+	return methods, nil
+}
+
+func lookupDuration(k string, v *time.Duration) error {
+	s := os.Getenv(k)
+	if s == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Wrap(err, k)
+	}
+
+	*v = d
+
+	return nil
+}
+
+func lookupInt(k string, v *int) error {
+	s := os.Getenv(k)
+	if s == "" {
+		return nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.Wrap(err, k)
+	}
+
+	*v = i
+
+	return nil
+}
+
+func lookupFloat(k string, v *float64) error {
+	s := os.Getenv(k)
+	if s == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.Wrap(err, k)
+	}
+
+	*v = f
+
+	return nil
+}
+
+func lookupStatusCodes(k string, v *StatusCodes) error {
+	s := os.Getenv(k)
+	if s == "" {
+		return nil
+	}
+
+	codes, err := ParseStatusCodes(s)
+	if err != nil {
+		return errors.Wrap(err, k)
+	}
+
+	*v = codes
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	var providerTests = []struct {
+		value    string
+		expected StatusCodes
+	}{
+		{"", StatusCodes{}},
+		{"404", StatusCodes{{404, 404}}},
+		{"2xx,404", StatusCodes{{200, 299}, {404, 404}}},
+		{"5XX", StatusCodes{{500, 599}}},
+		{"500-504, 429", StatusCodes{{500, 504}, {429, 429}}},
+	}
+
+	for _, test := range providerTests {
+		codes, err := ParseStatusCodes(test.value)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, codes)
+	}
+}
+
+func TestParseInvalidStatusCodes(t *testing.T) {
+	var providerTests = []struct {
+		value    string
+		expected string
+	}{
+		{"foo", `invalid status code "foo"`},
+		{"6xx", `invalid status code class "6xx"`},
+		{"99", `invalid status code "99"`},
+		{"504-500", `invalid status code range "504-500"`},
+		{"500-bar", `invalid status code "bar"`},
+	}
+
+	for _, test := range providerTests {
+		_, err := ParseStatusCodes(test.value)
+		assert.EqualError(t, err, test.expected)
+	}
+}
+
+func TestParseExitCodes(t *testing.T) {
+	codes, err := ParseExitCodes("75, 64-70")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodes{{75, 75}, {64, 70}}, codes)
+
+	var providerTests = []struct {
+		value    string
+		expected string
+	}{
+		{"0", `invalid exit code "0"`},
+		{"256", `invalid exit code "256"`},
+		{"1xx", `invalid exit code "1xx"`},
+		{"70-64", `invalid exit code range "70-64"`},
+	}
+
+	for _, test := range providerTests {
+		_, err := ParseExitCodes(test.value)
+		assert.EqualError(t, err, test.expected)
+	}
+}
+
+func TestStatusCodesContains(t *testing.T) {
+	codes := StatusCodes{{200, 299}, {404, 404}}
+
+	assert.True(t, codes.Contains(200))
+	assert.True(t, codes.Contains(204))
+	assert.True(t, codes.Contains(404))
+	assert.False(t, codes.Contains(403))
+	assert.False(t, StatusCodes{}.Contains(200))
+}
+
+func TestMethodRetryOptions(t *testing.T) {
+	testEnv := map[string]string{
+		"AGENT_RETRY_SUCCESS_CODES_PURGE": "2xx,404",
+		"AGENT_RETRY_MAX_ATTEMPTS_BAN":    "1",
+		"AGENT_RETRY_DELAY_BAN":           "1s",
+	}
+	for k, v := range testEnv {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	defaults := RetryOptions{
+		Delay:        time.Minute,
+		RetryOnError: true,
+		SuccessCodes: StatusCodes{{200, 299}},
+	}
+
+	methods, err := newMethodRetryOptionsFromEnv(defaults)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RetryOptions{
+		"PURGE": {
+			Delay:        time.Minute,
+			RetryOnError: true,
+			SuccessCodes: StatusCodes{{200, 299}, {404, 404}},
+		},
+		"BAN": {
+			Delay:        time.Second,
+			MaxAttempts:  1,
+			RetryOnError: true,
+			SuccessCodes: StatusCodes{{200, 299}},
+		},
+	}, methods)
+}
+
+func TestInvalidRetryOptions(t *testing.T) {
+	os.Setenv("AGENT_RETRY_CODES_PURGE", "foo")
+	defer os.Unsetenv("AGENT_RETRY_CODES_PURGE")
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `AGENT_RETRY_CODES_PURGE: invalid status code "foo"`)
+}
+
+func TestInvalidRetryBounds(t *testing.T) {
+	var providerTests = []struct {
+		key      string
+		value    string
+		expected string
+	}{
+		{"AGENT_RETRY_MAX_ATTEMPTS", "-1", `AGENT_RETRY_MAX_ATTEMPTS: unexpected number of attempts "-1"`},
+		{"AGENT_RETRY_JITTER", "1.5", `AGENT_RETRY_JITTER: unexpected factor "1.5", expected a value between 0 and 1`},
+		{"AGENT_RETRY_JITTER_PURGE", "-0.1", `AGENT_RETRY_JITTER_PURGE: unexpected factor "-0.1", expected a value between 0 and 1`},
+	}
+
+	for _, test := range providerTests {
+		os.Setenv(test.key, test.value)
+
+		_, err := NewOptionsFromEnv()
+		assert.EqualError(t, err, test.expected)
+
+		os.Unsetenv(test.key)
+	}
+}
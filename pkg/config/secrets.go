@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/secret"
+)
+
+// Providers of the secrets
+const (
+	SecretsProviderNone  = ""
+	SecretsProviderVault = "vault"
+)
+
+// Names of the secrets tracked by the secret store
+const (
+	SecretHubPublishToken   = "HUB_PUBLISH_TOKEN"
+	SecretHubSubscribeToken = "HUB_SUBSCRIBE_TOKEN"
+	SecretHubJWTKey         = "HUB_JWT_KEY"
+	SecretVaultToken        = "VAULT_TOKEN"
+)
+
+// SecretsOptions stores the options of the secrets read from files or fetched
+// from a secrets provider
+type SecretsOptions struct {
+	Provider        string
+	RefreshInterval time.Duration
+	VaultAddr       *url.URL
+	// Store holds the current value of the secrets read from files or
+	// fetched from the provider
+	Store *secret.Store
+}
+
+// secretsLoader reads the secrets defined in the environment.
+type secretsLoader struct {
+	store    *secret.Store
+	provider secret.Provider
+}
+
+func newSecretsOptionsFromEnv() (SecretsOptions, *secretsLoader, error) {
+	refreshInterval, err := time.ParseDuration(getEnv("SECRETS_REFRESH_INTERVAL", "1m"))
+	if err != nil {
+		return SecretsOptions{}, nil, errors.Wrap(err, "SECRETS_REFRESH_INTERVAL")
+	}
+
+	options := SecretsOptions{
+		Provider:        os.Getenv("SECRETS_PROVIDER"),
+		RefreshInterval: refreshInterval,
+		Store:           secret.NewStore(),
+	}
+
+	loader := &secretsLoader{store: options.Store}
+
+	switch options.Provider {
+	case SecretsProviderNone:
+	case SecretsProviderVault:
+		if options.VaultAddr, err = parseURL(os.Getenv("VAULT_ADDR")); err != nil {
+			return options, nil, errors.Wrap(err, "VAULT_ADDR")
+		}
+
+		if options.VaultAddr == nil {
+			return options, nil, fmt.Errorf("the following environment variable must be defined: %s", []string{"VAULT_ADDR"})
+		}
+
+		// the token of the provider can not be fetched from the provider
+		vaultToken, err := loader.get(SecretVaultToken)
+		if err != nil {
+			return options, nil, err
+		}
+
+		loader.provider = secret.NewVault(options.VaultAddr, func() string {
+			if token, ok := options.Store.Get(SecretVaultToken); ok {
+				return token
+			}
+
+			return vaultToken
+		})
+	default:
+		return options, nil, fmt.Errorf(`SECRETS_PROVIDER: unexpected provider "%s"`, options.Provider)
+	}
+
+	return options, loader, nil
+}
+
+// get returns the value of the first defined environment variable among keys.
+//
+// For each key, the secret is read from the file named by `<KEY>_FILE`, then
+// fetched from the provider with the reference held by `<KEY>_SECRET`, and
+// finally read from `<KEY>`. Secrets read from a file or fetched from the
+// provider are tracked by the store under the name of the first key, in order
+// to be reloaded.
+func (l *secretsLoader) get(keys ...string) (string, error) {
+	ctx := context.Background()
+
+	for _, k := range keys {
+		if file := os.Getenv(k + "_FILE"); file != "" {
+			v, err := l.store.Add(ctx, keys[0], secret.File(file))
+
+			return v, errors.Wrap(err, k+"_FILE")
+		}
+
+		if ref := os.Getenv(k + "_SECRET"); ref != "" {
+			if l.provider == nil {
+				return "", fmt.Errorf("%s_SECRET: no secrets provider defined", k)
+			}
+
+			v, err := l.store.Add(ctx, keys[0], secret.Ref{Provider: l.provider, Ref: ref})
+
+			return v, errors.Wrap(err, k+"_SECRET")
+		}
+
+		if v := os.Getenv(k); v != "" {
+			return v, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/secret/vaulttest"
+)
+
+func setEnv(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+
+	t.Cleanup(func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestSecretsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("file_token\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key"), []byte("file_key\n"), 0600))
+
+	setEnv(t, map[string]string{
+		"SERVER_ADDR":       ":80",
+		"HUB_ENDPOINT":      "http://hub/",
+		"HUB_TOKEN":         "token",
+		"HUB_TOKEN_FILE":    filepath.Join(dir, "token"),
+		"HUB_JWT_KEY_FILE":  filepath.Join(dir, "key"),
+		"HUB_PUBLISH_TOKEN": "publish_token",
+	})
+
+	opts, err := NewOptionsFromEnv()
+	require.NoError(t, err)
+
+	// variables suffixed by _FILE have precedence over the plain variables,
+	// but not over more specific variables
+	assert.Equal(t, "publish_token", opts.Hub.PublishToken)
+	assert.Equal(t, "file_token", opts.Hub.SubscribeToken)
+	assert.Equal(t, "file_key", opts.Hub.JWT.Key)
+
+	_, ok := opts.Secrets.Store.Get(SecretHubPublishToken)
+	assert.False(t, ok)
+
+	value, ok := opts.Secrets.Store.Get(SecretHubSubscribeToken)
+	assert.True(t, ok)
+	assert.Equal(t, "file_token", value)
+
+	value, ok = opts.Secrets.Store.Get(SecretHubJWTKey)
+	assert.True(t, ok)
+	assert.Equal(t, "file_key", value)
+}
+
+func TestSecretsFromMissingFile(t *testing.T) {
+	setEnv(t, map[string]string{
+		"HUB_TOKEN_FILE": filepath.Join(t.TempDir(), "missing"),
+	})
+
+	_, err := NewOptionsFromEnv()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "HUB_TOKEN_FILE: ")
+}
+
+func TestSecretsFromVault(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "vault"), []byte("root"), 0600))
+
+	server := vaulttest.NewServer("root")
+	defer server.Close()
+	server.Put("secret/http-broadcast", map[string]interface{}{"publish_token": "vault_token"})
+
+	setEnv(t, map[string]string{
+		"SERVER_ADDR":              ":80",
+		"HUB_ENDPOINT":             "http://hub/",
+		"HUB_PUBLISH_TOKEN_SECRET": "secret/http-broadcast#publish_token",
+		"SECRETS_PROVIDER":         "vault",
+		"VAULT_ADDR":               server.URL,
+		"VAULT_TOKEN_FILE":         filepath.Join(dir, "vault"),
+	})
+
+	opts, err := NewOptionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "vault_token", opts.Hub.PublishToken)
+	assert.Equal(t, SecretsProviderVault, opts.Secrets.Provider)
+	assert.Equal(t, server.URL, opts.Secrets.VaultAddr.String())
+
+	// secrets are fetched again on refresh
+	server.Put("secret/http-broadcast", map[string]interface{}{"publish_token": "rotated"})
+	opts.Secrets.Store.Refresh(context.Background())
+
+	value, _ := opts.Secrets.Store.Get(SecretHubPublishToken)
+	assert.Equal(t, "rotated", value)
+}
+
+func TestSecretsFromVaultError(t *testing.T) {
+	server := vaulttest.NewServer("root")
+	defer server.Close()
+
+	setEnv(t, map[string]string{
+		"HUB_PUBLISH_TOKEN_SECRET": "secret/http-broadcast#publish_token",
+		"SECRETS_PROVIDER":         "vault",
+		"VAULT_ADDR":               server.URL,
+		"VAULT_TOKEN":              "root",
+	})
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `HUB_PUBLISH_TOKEN_SECRET: vault: unexpected "404" code reading "secret/http-broadcast"`)
+}
+
+func TestSecretsWithoutProvider(t *testing.T) {
+	setEnv(t, map[string]string{
+		"HUB_TOKEN_SECRET": "secret/http-broadcast#token",
+	})
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, "HUB_TOKEN_SECRET: no secrets provider defined")
+}
+
+func TestInvalidSecretsProvider(t *testing.T) {
+	setEnv(t, map[string]string{
+		"SECRETS_PROVIDER": "aws",
+	})
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, `SECRETS_PROVIDER: unexpected provider "aws"`)
+}
+
+func TestMissingVaultAddr(t *testing.T) {
+	setEnv(t, map[string]string{
+		"SECRETS_PROVIDER": "vault",
+	})
+
+	_, err := NewOptionsFromEnv()
+	assert.EqualError(t, err, "the following environment variable must be defined: [VAULT_ADDR]")
+}
@@ -0,0 +1,118 @@
+package dto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings of the body of a Request
+const (
+	// EncodingNone leaves the body uncompressed
+	EncodingNone = "none"
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// IsEncoding returns whether the encoding is supported.
+func IsEncoding(encoding string) bool {
+	switch encoding {
+	case EncodingNone, EncodingGzip, EncodingZstd:
+		return true
+	}
+
+	return false
+}
+
+// Encode compresses the body of the request with the given encoding.
+func (r *Request) Encode(encoding string) error {
+	var buf bytes.Buffer
+
+	w, err := newEncoder(encoding, &buf)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(r.Body); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	r.Body = buf.Bytes()
+	r.Encoding = encoding
+
+	return nil
+}
+
+// Decode restores the original body of a request compressed by Encode. It
+// fails when the decoded body exceeds maxSize bytes, a maxSize of 0 means no
+// limit.
+func (r *Request) Decode(maxSize int64) error {
+	if r.Encoding == "" {
+		return nil
+	}
+
+	rd, err := newDecoder(r.Encoding, bytes.NewReader(r.Body), maxSize)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	var src io.Reader = rd
+	if maxSize > 0 {
+		src = io.LimitReader(rd, maxSize+1)
+	}
+
+	body, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return fmt.Errorf("decoded body exceeds %d bytes", maxSize)
+	}
+
+	r.Body = body
+	r.Encoding = ""
+
+	return nil
+}
+
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w)
+	}
+
+	return nil, fmt.Errorf(`unsupported encoding "%s"`, encoding)
+}
+
+func newDecoder(encoding string, r io.Reader, maxSize int64) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingZstd:
+		var options []zstd.DOption
+		if maxSize > 0 {
+			options = append(options, zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		}
+
+		d, err := zstd.NewReader(r, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf(`unsupported encoding "%s"`, encoding)
+}
@@ -0,0 +1,67 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	body := bytes.Repeat([]byte("Hello world "), 1000)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		r := &Request{Body: body}
+		require.NoError(t, r.Encode(encoding))
+		assert.Equal(t, encoding, r.Encoding)
+		assert.Less(t, len(r.Body), len(body))
+
+		data, err := json.Marshal(r)
+		require.NoError(t, err)
+
+		var decoded Request
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.NoError(t, decoded.Decode(0))
+		assert.Equal(t, "", decoded.Encoding)
+		assert.Equal(t, body, decoded.Body)
+	}
+}
+
+func TestDecodeWithoutEncoding(t *testing.T) {
+	r := &Request{Body: []byte("body")}
+	require.NoError(t, r.Decode(0))
+	assert.Equal(t, "body", string(r.Body))
+}
+
+func TestDecodeMaxSize(t *testing.T) {
+	body := bytes.Repeat([]byte("0"), 10*1024*1024)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		r := &Request{Body: body}
+		require.NoError(t, r.Encode(encoding))
+		assert.Less(t, len(r.Body), 64*1024)
+
+		encoded := *r
+		assert.Error(t, r.Decode(1024*1024), encoding)
+
+		require.NoError(t, encoded.Decode(int64(len(body))), encoding)
+		assert.Equal(t, body, encoded.Body)
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	r := &Request{Body: []byte("body")}
+	assert.EqualError(t, r.Encode("br"), `unsupported encoding "br"`)
+	assert.False(t, IsEncoding("br"))
+	assert.True(t, IsEncoding(EncodingNone))
+
+	r.Encoding = "br"
+	assert.EqualError(t, r.Decode(0), `unsupported encoding "br"`)
+}
+
+func TestDecodeInvalidBody(t *testing.T) {
+	r := &Request{Body: []byte("body"), Encoding: EncodingGzip}
+	assert.Error(t, r.Decode(0))
+}
@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// InvalidationMethod is the method of the requests holding an Invalidation
+const InvalidationMethod = "INVALIDATE"
+
+// Invalidation is a cache invalidation intent, translated by each agent into
+// the requests understood by its target.
+type Invalidation struct {
+	// URLs to purge, absolute or relative to the host of the target
+	URLs []string `json:",omitempty" msgpack:",omitempty"`
+	// Bans are regular expressions matching the URLs to ban
+	Bans []string `json:",omitempty" msgpack:",omitempty"`
+	// Tags are the surrogate keys of the objects to purge
+	Tags []string `json:",omitempty" msgpack:",omitempty"`
+}
+
+// Validate checks the invalidation is not empty and its bans are valid
+// regular expressions.
+func (i Invalidation) Validate() error {
+	if len(i.URLs) == 0 && len(i.Bans) == 0 && len(i.Tags) == 0 {
+		return errors.New("empty invalidation")
+	}
+
+	for _, ban := range i.Bans {
+		if _, err := regexp.Compile(ban); err != nil {
+			return errors.Wrapf(err, "invalid ban %q", ban)
+		}
+	}
+
+	return nil
+}
+
+// NewInvalidationRequest allocates and returns a new Request holding the
+// given invalidation.
+func NewInvalidationRequest(invalidation Invalidation) *Request {
+	return &Request{
+		ID:           NewID(),
+		Method:       InvalidationMethod,
+		Path:         "/",
+		Header:       http.Header{},
+		Invalidation: &invalidation,
+	}
+}
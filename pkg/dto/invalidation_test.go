@@ -0,0 +1,25 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidationValidate(t *testing.T) {
+	assert.NoError(t, Invalidation{URLs: []string{"/foo"}}.Validate())
+	assert.NoError(t, Invalidation{Bans: []string{"^/products/"}}.Validate())
+	assert.NoError(t, Invalidation{Tags: []string{"product-42"}}.Validate())
+
+	assert.EqualError(t, Invalidation{}.Validate(), "empty invalidation")
+	assert.EqualError(t, Invalidation{Bans: []string{"("}}.Validate(), "invalid ban \"(\": error parsing regexp: missing closing ): `(`")
+}
+
+func TestNewInvalidationRequest(t *testing.T) {
+	r := NewInvalidationRequest(Invalidation{Tags: []string{"product-42"}})
+
+	assert.Len(t, r.ID, 26)
+	assert.Equal(t, InvalidationMethod, r.Method)
+	assert.Equal(t, "/", r.Path)
+	assert.Equal(t, &Invalidation{Tags: []string{"product-42"}}, r.Invalidation)
+}
@@ -1,25 +1,50 @@
 package dto
 
 import (
+	"crypto/rand"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// GuardHeader is the header holding the tokens of the broadcasters the
+// request went through
+const GuardHeader = "X-HttpBroadcast-Guard"
+
+var (
+	entropyMu sync.Mutex
+	entropy   = ulid.Monotonic(rand.Reader, 0)
 )
 
 // Request is a serializable representation of an http request
 type Request struct {
-	Method string
-	Host   string
-	Path   string
-	Header http.Header
-	Body   []byte
+	ID       string `json:",omitempty" msgpack:",omitempty"`
+	Method   string
+	Host     string
+	Path     string
+	Header   http.Header
+	Body     []byte
+	Encoding string            `json:",omitempty" msgpack:",omitempty"`
+	Trace    map[string]string `json:",omitempty" msgpack:",omitempty"`
+
+	Invalidation *Invalidation `json:",omitempty" msgpack:",omitempty"`
 }
 
 // NewRequestFromHTTP allocates and returns a new Request from an http Request.
-func NewRequestFromHTTP(r *http.Request) *Request {
+func NewRequestFromHTTP(r *http.Request) (*Request, error) {
 	defer r.Body.Close()
-	b, _ := ioutil.ReadAll(r.Body)
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	request := &Request{
+		ID:     NewID(),
 		Method: strings.ToUpper(r.Method),
 		Host:   r.Host,
 		Path:   r.URL.Path,
@@ -27,5 +52,14 @@ func NewRequestFromHTTP(r *http.Request) *Request {
 		Body:   b,
 	}
 
-	return request
+	return request, nil
+}
+
+// NewID returns a unique and lexicographically sortable identifier (ULID)
+// used to recognize a message delivered several times.
+func NewID() string {
+	entropyMu.Lock()
+	defer entropyMu.Unlock()
+
+	return ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
 }
@@ -6,14 +6,30 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewRequestFromHTTP(t *testing.T) {
 	req, _ := http.NewRequest("method", "http://endpoint/path", bytes.NewBuffer([]byte("body")))
-	r := NewRequestFromHTTP(req)
+	r, err := NewRequestFromHTTP(req)
+	require.NoError(t, err)
 
 	assert.Equal(t, "METHOD", r.Method)
 	assert.Equal(t, "/path", r.Path)
 	assert.Equal(t, "endpoint", r.Host)
 	assert.Equal(t, "body", string(r.Body))
+	assert.Len(t, r.ID, 26)
+}
+
+func TestRequestIDsAreSortable(t *testing.T) {
+	var previous string
+
+	for i := 0; i < 100; i++ {
+		req, _ := http.NewRequest("GET", "http://endpoint/path", bytes.NewBuffer(nil))
+		r, err := NewRequestFromHTTP(req)
+		require.NoError(t, err)
+
+		assert.True(t, r.ID > previous)
+		previous = r.ID
+	}
 }
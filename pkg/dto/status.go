@@ -0,0 +1,33 @@
+package dto
+
+import (
+	"time"
+)
+
+// Status is a serializable event published by agents into the status topic
+type Status struct {
+	Ack       *Ack       `json:",omitempty"`
+	Heartbeat *Heartbeat `json:",omitempty"`
+}
+
+// Ack reports the outcome of the replay of a message by an agent
+type Ack struct {
+	MessageID  string
+	Agent      string
+	Success    bool
+	StatusCode int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+	Latency    time.Duration
+	Time       time.Time
+}
+
+// Heartbeat is periodically published by agents to announce they are alive
+type Heartbeat struct {
+	Agent       string
+	Version     string            `json:",omitempty"`
+	Endpoint    string            `json:",omitempty"`
+	LastEventID map[string]string `json:",omitempty"`
+	Pending     int
+	Lag         time.Duration
+	Time        time.Time
+}
@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Wire formats of a Request
+const (
+	FormatJSON    = "json"
+	FormatMsgpack = "msgpack"
+)
+
+// IsFormat returns whether the wire format is supported.
+func IsFormat(format string) bool {
+	return format == FormatJSON || format == FormatMsgpack
+}
+
+// versionMsgpack is the version of the envelope holding a msgpack document.
+// The first version of the envelope is a bare JSON document, later versions
+// are prefixed by their number followed by a dot, ie. "2.<payload>".
+const versionMsgpack = '2'
+
+// Marshal encodes the request in a versioned envelope using the given format.
+// The envelope is text safe, to be published as the data of an event.
+func Marshal(r Request, format string) ([]byte, error) {
+	switch format {
+	case "", FormatJSON:
+		return json.Marshal(r)
+	case FormatMsgpack:
+		b, err := msgpack.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, 2+base64.RawURLEncoding.EncodedLen(len(b)))
+		data[0], data[1] = versionMsgpack, '.'
+		base64.RawURLEncoding.Encode(data[2:], b)
+
+		return data, nil
+	}
+
+	return nil, fmt.Errorf(`unsupported format "%s"`, format)
+}
+
+// Unmarshal decodes a request encoded by Marshal, whatever the version of its
+// envelope.
+func Unmarshal(data []byte, r *Request) error {
+	if len(data) == 0 || data[0] == '{' {
+		return json.Unmarshal(data, r)
+	}
+
+	if len(data) < 2 || data[1] != '.' {
+		return fmt.Errorf("invalid envelope")
+	}
+
+	switch data[0] {
+	case versionMsgpack:
+		b := make([]byte, base64.RawURLEncoding.DecodedLen(len(data)-2))
+		n, err := base64.RawURLEncoding.Decode(b, data[2:])
+		if err != nil {
+			return err
+		}
+
+		return msgpack.Unmarshal(b[:n], r)
+	}
+
+	return fmt.Errorf(`unsupported envelope version "%c"`, data[0])
+}
@@ -0,0 +1,103 @@
+package dto
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWireRequest() Request {
+	return Request{
+		ID:     "01HF8M3X2R5T9V7YQ4K6B0C1DZ",
+		Method: "PURGE",
+		Host:   "www.example.com",
+		Path:   "/products/42",
+		Header: http.Header{
+			"Content-Type":    []string{"application/json"},
+			"User-Agent":      []string{"Go-http-client/1.1"},
+			"X-Forwarded-For": []string{"10.0.3.12"},
+			"X-Purge-Tags":    []string{"product-42", "category-7"},
+		},
+		Body:  bytes.Repeat([]byte(`{"tags":["product-42","category-7"]}`), 20),
+		Trace: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	for _, format := range []string{"", FormatJSON, FormatMsgpack} {
+		data, err := Marshal(newWireRequest(), format)
+		require.NoError(t, err)
+
+		var r Request
+		require.NoError(t, Unmarshal(data, &r))
+		assert.Equal(t, newWireRequest(), r)
+	}
+}
+
+func TestMarshalEnvelope(t *testing.T) {
+	data, err := Marshal(newWireRequest(), FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, byte('{'), data[0])
+
+	data, err = Marshal(newWireRequest(), FormatMsgpack)
+	require.NoError(t, err)
+	assert.Equal(t, "2.", string(data[:2]))
+	assert.Equal(t, string(data), url.QueryEscape(string(data)))
+}
+
+func TestMarshalUnsupportedFormat(t *testing.T) {
+	_, err := Marshal(newWireRequest(), "protobuf")
+	assert.EqualError(t, err, `unsupported format "protobuf"`)
+	assert.False(t, IsFormat("protobuf"))
+	assert.True(t, IsFormat(FormatMsgpack))
+}
+
+func TestUnmarshalInvalidEnvelope(t *testing.T) {
+	var r Request
+	assert.EqualError(t, Unmarshal([]byte("foo"), &r), "invalid envelope")
+	assert.EqualError(t, Unmarshal([]byte("9.foo"), &r), `unsupported envelope version "9"`)
+	assert.Error(t, Unmarshal([]byte("2.!!!"), &r))
+}
+
+func benchmarkWire(b *testing.B, format string) {
+	request := newWireRequest()
+
+	var size int
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		data, err := Marshal(request, format)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		// the hub receives the data URL-encoded in a form
+		form := url.Values{"data": []string{string(data)}}.Encode()
+		size = len(form)
+
+		values, err := url.ParseQuery(form)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		var r Request
+		if err := Unmarshal([]byte(values.Get("data")), &r); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(size), "bytes/msg")
+}
+
+func BenchmarkWireJSON(b *testing.B) {
+	benchmarkWire(b, FormatJSON)
+}
+
+func BenchmarkWireMsgpack(b *testing.B) {
+	benchmarkWire(b, FormatMsgpack)
+}
@@ -0,0 +1,108 @@
+// Package headerpolicy filters the headers of the broadcasted requests.
+package headerpolicy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// hopByHopHeaders are meaningful only for a single connection and are never
+// broadcasted. Content-Length is computed again from the body on replay.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Policy filters headers with an allow list and a deny list. Patterns are
+// header names, optionally ending with `*` to match a prefix.
+type Policy struct {
+	allow []string
+	deny  []string
+}
+
+// Apply returns a copy of the header without the hop-by-hop headers, the
+// headers not allowed, and the headers denied. The loop guard header is
+// always preserved.
+func (p *Policy) Apply(header http.Header) http.Header {
+	h := http.Header{}
+
+	connection := map[string]bool{}
+	for _, v := range header["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			connection[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+
+	for name, values := range header {
+		name = http.CanonicalHeaderKey(name)
+		if name != http.CanonicalHeaderKey(dto.GuardHeader) {
+			if connection[name] || match(hopByHopHeaders, name) {
+				continue
+			}
+
+			if len(p.allow) > 0 && !match(p.allow, name) {
+				continue
+			}
+
+			if match(p.deny, name) {
+				continue
+			}
+		}
+
+		h[name] = append([]string(nil), values...)
+	}
+
+	return h
+}
+
+func match(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+
+			continue
+		}
+
+		if name == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canonicalPatterns(patterns []string) []string {
+	canonical := make([]string, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if strings.HasSuffix(pattern, "*") {
+			canonical = append(canonical, http.CanonicalHeaderKey(strings.TrimSuffix(pattern, "*"))+"*")
+		} else {
+			canonical = append(canonical, http.CanonicalHeaderKey(pattern))
+		}
+	}
+
+	return canonical
+}
+
+// New allocates and returns a new Policy.
+func New(options config.HeaderPolicyOptions) *Policy {
+	return &Policy{
+		allow: canonicalPatterns(options.Allow),
+		deny:  canonicalPatterns(options.Deny),
+	}
+}
@@ -0,0 +1,63 @@
+package headerpolicy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+func newHeader() http.Header {
+	return http.Header{
+		"Connection":            []string{"keep-alive, X-Hop"},
+		"X-Hop":                 []string{"hop"},
+		"Content-Length":        []string{"5"},
+		"Transfer-Encoding":     []string{"chunked"},
+		"Cookie":                []string{"session=secret"},
+		"X-Forwarded-For":       []string{"1.2.3.4"},
+		"X-Forwarded-Host":      []string{"example.com"},
+		"X-Purge-Tags":          []string{"foo", "bar"},
+		"X-Httpbroadcast-Guard": []string{"token"},
+	}
+}
+
+func TestApplyDropsHopByHopHeaders(t *testing.T) {
+	h := New(config.HeaderPolicyOptions{}).Apply(newHeader())
+
+	assert.Equal(t, http.Header{
+		"Cookie":                []string{"session=secret"},
+		"X-Forwarded-For":       []string{"1.2.3.4"},
+		"X-Forwarded-Host":      []string{"example.com"},
+		"X-Purge-Tags":          []string{"foo", "bar"},
+		"X-Httpbroadcast-Guard": []string{"token"},
+	}, h)
+}
+
+func TestApplyDeny(t *testing.T) {
+	h := New(config.HeaderPolicyOptions{Deny: []string{"cookie", "x-forwarded-*", "X-Httpbroadcast-Guard"}}).Apply(newHeader())
+
+	assert.Equal(t, http.Header{
+		"X-Purge-Tags":          []string{"foo", "bar"},
+		"X-Httpbroadcast-Guard": []string{"token"},
+	}, h)
+}
+
+func TestApplyAllow(t *testing.T) {
+	h := New(config.HeaderPolicyOptions{Allow: []string{"X-Purge-*", "X-Forwarded-For", "Content-Length"}, Deny: []string{"X-Forwarded-For"}}).Apply(newHeader())
+
+	assert.Equal(t, http.Header{
+		"X-Purge-Tags":          []string{"foo", "bar"},
+		"X-Httpbroadcast-Guard": []string{"token"},
+	}, h)
+}
+
+func TestApplyDoesNotModifyHeader(t *testing.T) {
+	header := newHeader()
+	h := New(config.HeaderPolicyOptions{}).Apply(header)
+	h["X-Purge-Tags"][0] = "baz"
+
+	assert.Equal(t, newHeader(), header)
+	assert.Equal(t, http.Header{}, New(config.HeaderPolicyOptions{}).Apply(nil))
+}
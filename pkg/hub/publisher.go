@@ -0,0 +1,188 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/token"
+)
+
+// Message is an update pushed into the hub
+type Message struct {
+	ID     string `json:",omitempty"`
+	Topic  string
+	Target string
+	Data   []byte
+	// Token overrides the provider of the publish tokens of the publisher
+	Token token.Provider `json:"-"`
+}
+
+// ResponseError is returned when a hub responds with an error code.
+type ResponseError struct {
+	StatusCode int
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf(`invalid response from Hub: "%d" code`, e.StatusCode)
+}
+
+// Permanent returns whether publishing the message again is pointless: the
+// hub rejected it with a client error other than 429 Too Many Requests.
+func (e *ResponseError) Permanent() bool {
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError && e.StatusCode != http.StatusTooManyRequests
+}
+
+// IsPermanent returns whether the error is a permanent rejection of the
+// message by the hub.
+func IsPermanent(err error) bool {
+	var responseErr *ResponseError
+
+	return errors.As(err, &responseErr) && responseErr.Permanent()
+}
+
+// Publisher pushes messages into one or several hubs.
+type Publisher struct {
+	endpoints []*url.URL
+	mode      string
+	token     token.Provider
+	client    *http.Client
+}
+
+// Publish pushes the message into the hubs.
+//
+// In failover mode, hubs are tried in order until one accepts the message.
+// In fanout mode, the message is pushed to all the hubs, and Publish
+// succeeds when at least one hub accepts the message.
+func (p *Publisher) Publish(m Message) error {
+	if len(p.endpoints) == 0 {
+		return errors.New("no hub defined")
+	}
+
+	if p.mode == config.PublishModeFanout {
+		return p.fanout(m)
+	}
+
+	return p.failover(m)
+}
+
+func (p *Publisher) failover(m Message) error {
+	var err error
+
+	for _, endpoint := range p.endpoints {
+		if err = p.publishTo(endpoint, m); err == nil {
+			return nil
+		}
+
+		log.WithFields(log.Fields{"hub": endpoint.String()}).Warn(err)
+	}
+
+	return err
+}
+
+func (p *Publisher) fanout(m Message) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for _, endpoint := range p.endpoints {
+		wg.Add(1) //nolint:gomnd
+
+		go func(endpoint *url.URL) {
+			defer wg.Done()
+
+			if err := p.publishTo(endpoint, m); err != nil {
+				log.WithFields(log.Fields{"hub": endpoint.String()}).Warn(err)
+
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(endpoint)
+	}
+
+	wg.Wait()
+
+	if len(errs) == len(p.endpoints) {
+		return errs[0]
+	}
+
+	return nil
+}
+
+func (p *Publisher) publishTo(endpoint *url.URL, m Message) error {
+	log.WithFields(log.Fields{"id": m.ID, "size": len(m.Data), "topic": m.Topic, "target": m.Target, "hub": endpoint.String()}).Debug("Hub: Pushing message")
+
+	form := url.Values{}
+	if m.ID != "" {
+		form.Set("id", m.ID)
+	}
+
+	form.Set("topic", m.Topic)
+	form.Set("target", m.Target)
+	form.Set("data", string(m.Data))
+	formData := form.Encode()
+
+	hubRequest, _ := http.NewRequest("POST", endpoint.String(), strings.NewReader(formData))
+
+	provider := p.token
+	if m.Token != nil {
+		provider = m.Token
+	}
+
+	authorization, _, err := provider.Token()
+	if err != nil {
+		return errors.Wrap(err, "mint token")
+	}
+
+	if authorization != "" {
+		hubRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authorization))
+	}
+
+	hubRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	hubRequest.Header.Add("Content-Length", strconv.Itoa(len(formData)))
+
+	hubResponse, err := p.client.Do(hubRequest)
+	if err != nil {
+		return errors.Wrap(err, "push record")
+	}
+
+	defer hubResponse.Body.Close()
+
+	if hubResponse.StatusCode >= http.StatusBadRequest {
+		respStr, _ := httputil.DumpResponse(hubResponse, true)
+
+		log.WithFields(log.Fields{"response": string(respStr)}).Debug("Hub: invalid response")
+
+		return &ResponseError{StatusCode: hubResponse.StatusCode}
+	}
+
+	return nil
+}
+
+// SetTokenProvider replaces the provider of the tokens used to publish.
+func (p *Publisher) SetTokenProvider(provider token.Provider) {
+	p.token = provider
+}
+
+// NewPublisher allocates and returns a new Publisher.
+func NewPublisher(options config.HubOptions) *Publisher {
+	return &Publisher{
+		endpoints: options.Endpoints,
+		mode:      options.PublishMode,
+		token:     token.Static(options.PublishToken),
+		client: &http.Client{
+			Timeout: options.Timeout,
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/token"
+)
+
+func newHub(status int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.WriteHeader(status)
+	}))
+}
+
+func TestPublish(t *testing.T) {
+	var form url.Values
+	var authorization string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(b))
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer hub.Close()
+
+	p := NewPublisher(config.HubOptions{
+		Endpoints:    []*url.URL{parseSafeURL(hub.URL)},
+		PublishToken: "token",
+	})
+
+	err := p.Publish(Message{ID: "my-id", Topic: "my-topic", Target: "my-target", Data: []byte("data")})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token", authorization)
+	assert.Equal(t, "my-id", form.Get("id"))
+	assert.Equal(t, "my-topic", form.Get("topic"))
+	assert.Equal(t, "my-target", form.Get("target"))
+	assert.Equal(t, "data", form.Get("data"))
+
+	err = p.Publish(Message{Topic: "my-topic", Data: []byte("data"), Token: token.Static("tenant-token")})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer tenant-token", authorization)
+}
+
+func TestPublishFailover(t *testing.T) {
+	var calls1, calls2, calls3 int32
+	hub1 := newHub(http.StatusBadGateway, &calls1)
+	defer hub1.Close()
+	hub2 := newHub(http.StatusOK, &calls2)
+	defer hub2.Close()
+	hub3 := newHub(http.StatusOK, &calls3)
+	defer hub3.Close()
+
+	p := NewPublisher(config.HubOptions{
+		Endpoints:   []*url.URL{parseSafeURL(hub1.URL), parseSafeURL(hub2.URL), parseSafeURL(hub3.URL)},
+		PublishMode: config.PublishModeFailover,
+	})
+
+	require.NoError(t, p.Publish(Message{}))
+	assert.Equal(t, int32(1), calls1)
+	assert.Equal(t, int32(1), calls2)
+	assert.Equal(t, int32(0), calls3)
+}
+
+func TestPublishFanout(t *testing.T) {
+	var calls1, calls2 int32
+	hub1 := newHub(http.StatusBadGateway, &calls1)
+	defer hub1.Close()
+	hub2 := newHub(http.StatusOK, &calls2)
+	defer hub2.Close()
+
+	p := NewPublisher(config.HubOptions{
+		Endpoints:   []*url.URL{parseSafeURL(hub2.URL), parseSafeURL(hub1.URL)},
+		PublishMode: config.PublishModeFanout,
+	})
+
+	require.NoError(t, p.Publish(Message{}))
+	assert.Equal(t, int32(1), calls1)
+	assert.Equal(t, int32(1), calls2)
+}
+
+func TestPublishError(t *testing.T) {
+	var calls int32
+	hub := newHub(http.StatusBadGateway, &calls)
+	defer hub.Close()
+
+	for _, mode := range []string{config.PublishModeFailover, config.PublishModeFanout} {
+		p := NewPublisher(config.HubOptions{
+			Endpoints:   []*url.URL{parseSafeURL(hub.URL), parseSafeURL("http://127.0.0.1:666")},
+			PublishMode: mode,
+		})
+
+		assert.Error(t, p.Publish(Message{}))
+	}
+
+	assert.EqualError(t, NewPublisher(config.HubOptions{}).Publish(Message{}), "no hub defined")
+}
+
+func TestIsPermanent(t *testing.T) {
+	var providerTests = []struct {
+		code      int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+	}
+
+	for _, test := range providerTests {
+		var calls int32
+		hub := newHub(test.code, &calls)
+
+		err := NewPublisher(config.HubOptions{Endpoints: []*url.URL{parseSafeURL(hub.URL)}}).Publish(Message{})
+		assert.Equal(t, test.permanent, IsPermanent(err), test.code)
+
+		hub.Close()
+	}
+
+	assert.False(t, IsPermanent(errors.New("push record")))
+}
+
+func parseSafeURL(urlString string) *url.URL {
+	u, _ := url.Parse(urlString)
+	return u
+}
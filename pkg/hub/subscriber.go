@@ -0,0 +1,144 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+	"github.com/r3labs/sse"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/token"
+)
+
+const defaultMaxInterval = 5 * time.Second
+
+// Subscription describes a subscription to a topic of a hub.
+type Subscription struct {
+	Endpoint    *url.URL
+	Topic       string
+	Token       token.Provider
+	LastEventID string
+}
+
+// URL returns the URL of the hub's endpoint subscribing to the topic.
+func (s Subscription) URL() string {
+	hubURL, _ := url.Parse(s.Endpoint.String())
+	q := hubURL.Query()
+	q.Set("topic", s.Topic)
+	hubURL.RawQuery = q.Encode()
+
+	return hubURL.String()
+}
+
+// Subscribe subscribes to the topic and sends the received events into the
+// channel until the context is canceled. Reconnections are handled
+// automatically, and the connection is renewed with a new token when the
+// token should be renewed.
+func Subscribe(ctx context.Context, s Subscription, events chan *sse.Event) error {
+	client := sse.NewClient(s.URL())
+	if s.Token != nil {
+		client.Connection.Transport = &tokenTransport{hub: s.URL(), token: s.Token, next: http.DefaultTransport}
+	}
+
+	client.EventID = s.LastEventID
+
+	client.OnDisconnect(func(c *sse.Client) {
+		log.WithFields(log.Fields{"hub": s.URL()}).Warn("hub: disconnected")
+	})
+
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxInterval = defaultMaxInterval
+	retry.MaxElapsedTime = 0
+	client.ReconnectStrategy = backoff.WithContext(retry, ctx)
+
+	if err := client.SubscribeChanWithContext(ctx, "", events); err != nil {
+		return errors.Wrap(err, "subscribe to stream")
+	}
+
+	return nil
+}
+
+// errTokenRenewal is returned by the streams closed to renew their token
+var errTokenRenewal = errors.New("token renewal")
+
+// tokenTransport authenticates each connection to the hub with the current
+// token, and closes the stream when the token should be renewed, so the
+// client reconnects with a new token.
+type tokenTransport struct {
+	hub   string
+	token token.Provider
+	next  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authorization, renewAt, err := t.token.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "mint token")
+	}
+
+	if authorization != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authorization))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || renewAt.IsZero() {
+		return resp, err
+	}
+
+	resp.Body = newRenewableBody(resp.Body, time.Until(renewAt), func() {
+		log.WithFields(log.Fields{"hub": t.hub}).Info("hub: renewing token")
+	})
+
+	return resp, nil
+}
+
+// renewableBody is a response body failing with errTokenRenewal once its
+// token should be renewed.
+type renewableBody struct {
+	io.ReadCloser
+
+	mu      sync.Mutex
+	renewed bool
+	timer   *time.Timer
+}
+
+func newRenewableBody(body io.ReadCloser, d time.Duration, onRenew func()) *renewableBody {
+	b := &renewableBody{ReadCloser: body}
+	b.timer = time.AfterFunc(d, func() {
+		b.mu.Lock()
+		b.renewed = true
+		b.mu.Unlock()
+
+		onRenew()
+		body.Close()
+	})
+
+	return b
+}
+
+func (b *renewableBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.renewed {
+		return n, errTokenRenewal
+	}
+
+	return n, err
+}
+
+func (b *renewableBody) Close() error {
+	b.timer.Stop()
+
+	return b.ReadCloser.Close()
+}
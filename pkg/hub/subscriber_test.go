@@ -0,0 +1,132 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/token"
+)
+
+func TestSubscriptionURL(t *testing.T) {
+	s := Subscription{
+		Endpoint: parseSafeURL("http://hub/.well-known/mercure?foo=bar"),
+		Topic:    "my-topic",
+	}
+
+	assert.Equal(t, "http://hub/.well-known/mercure?foo=bar&topic=my-topic", s.URL())
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := sse.New()
+	defer srv.Close()
+
+	var authorization string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		srv.HTTPHandler(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	srv.CreateStream("foo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *sse.Event)
+	err := Subscribe(ctx, Subscription{
+		Endpoint: parseSafeURL(server.URL + "/events?stream=foo"),
+		Topic:    "my-topic",
+		Token:    token.Static("token"),
+	}, events)
+	require.NoError(t, err)
+
+	srv.Publish("foo", &sse.Event{Data: []byte("data")})
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "data", string(event.Data))
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+
+	assert.Equal(t, "Bearer token", authorization)
+}
+
+type renewingToken struct {
+	count int32
+	ttl   time.Duration
+}
+
+func (r *renewingToken) Token() (string, time.Time, error) {
+	n := atomic.AddInt32(&r.count, 1)
+
+	return "token-" + strconv.Itoa(int(n)), time.Now().Add(r.ttl), nil
+}
+
+func TestSubscribeRenewToken(t *testing.T) {
+	srv := sse.New()
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var authorizations, lastEventIDs []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+		srv.HTTPHandler(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	srv.AutoReplay = false
+	srv.CreateStream("foo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *sse.Event)
+	err := Subscribe(ctx, Subscription{
+		Endpoint: parseSafeURL(server.URL + "/events?stream=foo"),
+		Topic:    "my-topic",
+		Token:    &renewingToken{ttl: 100 * time.Millisecond},
+	}, events)
+	require.NoError(t, err)
+
+	srv.Publish("foo", &sse.Event{ID: []byte("1"), Data: []byte("data")})
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "data", string(event.Data))
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(authorizations) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, "Bearer token-1", authorizations[0])
+	assert.Equal(t, "Bearer token-2", authorizations[1])
+	assert.Equal(t, "", lastEventIDs[0])
+	assert.Equal(t, "1", lastEventIDs[1])
+}
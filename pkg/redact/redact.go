@@ -0,0 +1,141 @@
+// Package redact removes the sensitive data from the requests and
+// responses written in logs.
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// Placeholder replaces the redacted values.
+const Placeholder = "[REDACTED]"
+
+// Redactor redacts the sensitive headers and the parts of bodies matching
+// a pattern, and truncates large bodies.
+type Redactor struct {
+	headers     []string
+	bodyPattern *regexp.Regexp
+	maxBodySize int
+}
+
+// Header returns a copy of the header with the values of the sensitive
+// headers redacted.
+func (r *Redactor) Header(header http.Header) http.Header {
+	h := header.Clone()
+	for _, name := range r.headers {
+		if _, ok := h[name]; ok {
+			h.Set(name, Placeholder)
+		}
+	}
+
+	return h
+}
+
+// Body returns a copy of the body with the sensitive data redacted,
+// truncated to the maximum size.
+func (r *Redactor) Body(body []byte) []byte {
+	if r.bodyPattern != nil {
+		body = r.bodyPattern.ReplaceAll(body, []byte(Placeholder))
+	}
+
+	if r.maxBodySize > 0 && len(body) > r.maxBodySize {
+		truncated := make([]byte, r.maxBodySize, r.maxBodySize+32)
+		copy(truncated, body)
+
+		return append(truncated, fmt.Sprintf("... (%d bytes truncated)", len(body)-r.maxBodySize)...)
+	}
+
+	return body
+}
+
+// Request returns a redacted copy of the request.
+func (r *Redactor) Request(request dto.Request) dto.Request {
+	request.Header = r.Header(request.Header)
+	request.Body = r.Body(request.Body)
+
+	return request
+}
+
+// DumpRequest returns the redacted wire representation of the request.
+// The body of the request is preserved.
+func (r *Redactor) DumpRequest(req *http.Request) string {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+
+		// the error, ie. a body exceeding its limit, is replayed to the next
+		// reader of the body
+		var r io.Reader = bytes.NewReader(body)
+		if err != nil {
+			r = io.MultiReader(r, errReader{err})
+		}
+
+		req.Body = ioutil.NopCloser(r)
+	}
+
+	clone := *req
+	clone.Header = r.Header(req.Header)
+	clone.Body = nil
+
+	dump, err := httputil.DumpRequest(&clone, false)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(append(dump, r.Body(body)...))
+}
+
+// errReader returns the error met while reading the original body.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// DumpResponse returns the redacted wire representation of the response.
+// The body of the response is preserved.
+func (r *Redactor) DumpResponse(resp *http.Response) string {
+	var body []byte
+	if resp.Body != nil {
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	clone := *resp
+	clone.Header = r.Header(resp.Header)
+	clone.Body = nil
+
+	dump, err := httputil.DumpResponse(&clone, false)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(append(dump, r.Body(body)...))
+}
+
+// New allocates and returns a new Redactor.
+func New(options config.LogOptions) *Redactor {
+	headers := make([]string, 0, len(options.RedactHeaders))
+	for _, name := range options.RedactHeaders {
+		headers = append(headers, http.CanonicalHeaderKey(name))
+	}
+
+	return &Redactor{
+		headers:     headers,
+		bodyPattern: options.RedactBodyPattern,
+		maxBodySize: options.MaxBodySize,
+	}
+}
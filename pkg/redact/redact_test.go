@@ -0,0 +1,106 @@
+package redact
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func newTestRedactor() *Redactor {
+	return New(config.LogOptions{
+		RedactHeaders:     []string{"authorization", "Cookie"},
+		RedactBodyPattern: regexp.MustCompile(`password=[^&]*`),
+		MaxBodySize:       20,
+	})
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("X-Custom", "value")
+
+	redacted := newTestRedactor().Header(h)
+	assert.Equal(t, Placeholder, redacted.Get("Authorization"))
+	assert.Equal(t, "value", redacted.Get("X-Custom"))
+	assert.NotContains(t, redacted, "Cookie")
+	assert.Equal(t, "Bearer secret", h.Get("Authorization"))
+}
+
+func TestBody(t *testing.T) {
+	r := newTestRedactor()
+
+	assert.Equal(t, "user=foo&[REDACTED]", string(r.Body([]byte("user=foo&password=bar"))))
+	assert.Equal(t, "0123456789abcdefghij... (6 bytes truncated)", string(r.Body([]byte("0123456789abcdefghijklmnop"))))
+	assert.Equal(t, "0123456789abcdefghijklmnop", string(New(config.LogOptions{}).Body([]byte("0123456789abcdefghijklmnop"))))
+}
+
+func TestRequest(t *testing.T) {
+	request := dto.Request{
+		Method: "POST",
+		Header: http.Header{"Cookie": []string{"session=secret"}},
+		Body:   []byte("password=secret"),
+	}
+
+	redacted := newTestRedactor().Request(request)
+	assert.Equal(t, "POST", redacted.Method)
+	assert.Equal(t, Placeholder, redacted.Header.Get("Cookie"))
+	assert.Equal(t, Placeholder, string(redacted.Body))
+	assert.Equal(t, "session=secret", request.Header.Get("Cookie"))
+	assert.Equal(t, "password=secret", string(request.Body))
+}
+
+func TestDumpRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/foo", strings.NewReader("user=foo&password=bar"))
+	req.Header.Set("Authorization", "Bearer secret")
+
+	dump := newTestRedactor().DumpRequest(req)
+	assert.Contains(t, dump, "POST /foo HTTP/1.1")
+	assert.Contains(t, dump, "Authorization: [REDACTED]")
+	assert.Contains(t, dump, "user=foo&[REDACTED]")
+	assert.NotContains(t, dump, "secret")
+	assert.NotContains(t, dump, "bar")
+
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, "user=foo&password=bar", string(body))
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+}
+
+func TestDumpRequestReadError(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/foo", strings.NewReader("Hello"))
+	req.Body = http.MaxBytesReader(w, req.Body, 4)
+
+	dump := newTestRedactor().DumpRequest(req)
+	assert.Contains(t, dump, "Hell")
+
+	// the error is kept for the next reader of the body
+	_, err := ioutil.ReadAll(req.Body)
+	assert.Error(t, err)
+}
+
+func TestDumpResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Set-Cookie": []string{"session=secret"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString("password=secret")),
+	}
+
+	dump := New(config.LogOptions{RedactHeaders: []string{"Set-Cookie"}, RedactBodyPattern: regexp.MustCompile(`password=\w+`)}).DumpResponse(resp)
+	assert.Contains(t, dump, "HTTP/1.1 200 OK")
+	assert.Contains(t, dump, "Set-Cookie: [REDACTED]")
+	assert.NotContains(t, dump, "secret")
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "password=secret", string(body))
+}
@@ -0,0 +1,161 @@
+package secret
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Provider fetches secrets from an external store.
+type Provider interface {
+	// Fetch returns the value of the secret referenced by ref.
+	Fetch(ctx context.Context, ref string) (string, error)
+}
+
+// Source is where the value of a secret is read from.
+type Source interface {
+	Read(ctx context.Context) (string, error)
+}
+
+// File is a secret stored in a file, like Docker and Kubernetes secrets.
+// Trailing new lines are trimmed.
+type File string
+
+// Read returns the content of the file.
+func (f File) Read(context.Context) (string, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Ref is a secret fetched from a provider.
+type Ref struct {
+	Provider Provider
+	Ref      string
+}
+
+// Read fetches the secret from the provider.
+func (r Ref) Read(ctx context.Context) (string, error) {
+	return r.Provider.Fetch(ctx, r.Ref)
+}
+
+type entry struct {
+	source Source
+	value  string
+}
+
+// Store holds the current value of named secrets, and reloads them when they
+// change.
+type Store struct {
+	mu      sync.RWMutex
+	secrets map[string]*entry
+}
+
+// NewStore allocates and returns a new Store.
+func NewStore() *Store {
+	return &Store{secrets: map[string]*entry{}}
+}
+
+// Add reads the secret from the source and registers it under the name.
+func (s *Store) Add(ctx context.Context, name string, source Source) (string, error) {
+	value, err := source.Read(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.secrets[name] = &entry{source: source, value: value}
+	s.mu.Unlock()
+
+	return value, nil
+}
+
+// Get returns the current value of the secret, and whether the secret is
+// registered.
+func (s *Store) Get(name string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.secrets[name]
+	if !ok {
+		return "", false
+	}
+
+	return e.value, true
+}
+
+// Refresh reads the secrets again from their sources. Secrets failing to be
+// read keep their previous value.
+//
+// Secrets read from files, which hold the credentials of the providers, are
+// refreshed before the secrets fetched from the providers, so that the latter
+// are fetched with up to date credentials.
+func (s *Store) Refresh(ctx context.Context) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		_, iRef := s.secrets[names[i]].source.(Ref)
+		_, jRef := s.secrets[names[j]].source.(Ref)
+		if iRef != jRef {
+			return jRef
+		}
+
+		return names[i] < names[j]
+	})
+	s.mu.RUnlock()
+
+	for _, name := range names {
+		s.mu.RLock()
+		e := s.secrets[name]
+		s.mu.RUnlock()
+
+		value, err := e.source.Read(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{"secret": name}).Warn(errors.Wrap(err, "secret: reload"))
+
+			continue
+		}
+
+		s.mu.Lock()
+		changed := e.value != value
+		e.value = value
+		s.mu.Unlock()
+
+		if changed {
+			log.WithFields(log.Fields{"secret": name}).Info("secret: reloaded")
+		}
+	}
+}
+
+// Watch refreshes the secrets at the given interval until the context is
+// canceled.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
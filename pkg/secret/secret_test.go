@@ -0,0 +1,125 @@
+package secret
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, ioutil.WriteFile(file, []byte("token\r\n"), 0600))
+
+	value, err := File(file).Read(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token", value)
+
+	_, err = File(filepath.Join(t.TempDir(), "missing")).Read(context.Background())
+	assert.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, ioutil.WriteFile(file, []byte("token"), 0600))
+
+	s := NewStore()
+
+	value, err := s.Add(context.Background(), "TOKEN", File(file))
+	require.NoError(t, err)
+	assert.Equal(t, "token", value)
+
+	value, ok := s.Get("TOKEN")
+	assert.True(t, ok)
+	assert.Equal(t, "token", value)
+
+	_, ok = s.Get("OTHER")
+	assert.False(t, ok)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("rotated"), 0600))
+	s.Refresh(context.Background())
+
+	value, _ = s.Get("TOKEN")
+	assert.Equal(t, "rotated", value)
+
+	// the previous value is kept when the secret can not be read
+	require.NoError(t, os.Remove(file))
+	s.Refresh(context.Background())
+
+	value, _ = s.Get("TOKEN")
+	assert.Equal(t, "rotated", value)
+}
+
+type tokenProvider struct {
+	store *Store
+}
+
+func (p tokenProvider) Fetch(_ context.Context, ref string) (string, error) {
+	token, _ := p.store.Get("Z_TOKEN")
+
+	return ref + "-" + token, nil
+}
+
+func TestStoreRefreshCredentialsFirst(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(file, []byte("v1"), 0600))
+
+	s := NewStore()
+
+	_, err := s.Add(context.Background(), "Z_TOKEN", File(file))
+	require.NoError(t, err)
+
+	value, err := s.Add(context.Background(), "A_SECRET", Ref{Provider: tokenProvider{s}, Ref: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "secret-v1", value)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("v2"), 0600))
+	s.Refresh(context.Background())
+
+	value, _ = s.Get("A_SECRET")
+	assert.Equal(t, "secret-v2", value)
+}
+
+func TestStoreAddError(t *testing.T) {
+	s := NewStore()
+
+	_, err := s.Add(context.Background(), "TOKEN", File(filepath.Join(t.TempDir(), "missing")))
+	assert.Error(t, err)
+
+	_, ok := s.Get("TOKEN")
+	assert.False(t, ok)
+}
+
+func TestNilStore(t *testing.T) {
+	var s *Store
+
+	_, ok := s.Get("TOKEN")
+	assert.False(t, ok)
+}
+
+func TestWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, ioutil.WriteFile(file, []byte("token"), 0600))
+
+	s := NewStore()
+	_, err := s.Add(context.Background(), "TOKEN", File(file))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.Watch(ctx, 10*time.Millisecond)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("rotated"), 0600))
+
+	assert.Eventually(t, func() bool {
+		value, _ := s.Get("TOKEN")
+
+		return value == "rotated"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultVaultTimeout = 10 * time.Second
+
+// Vault fetches secrets from the KV version 2 secrets engine of a Vault
+// server.
+//
+// References have the form `<mount>/<path>#<key>`, ie.
+// `secret/http-broadcast#publish_token` reads the key `publish_token` of the
+// secret `http-broadcast` in the engine mounted on `secret`.
+type Vault struct {
+	addr   *url.URL
+	token  func() string
+	client *http.Client
+}
+
+// NewVault returns a provider fetching secrets from the Vault server at addr,
+// authenticated with the token returned by the token function.
+func NewVault(addr *url.URL, token func() string) *Vault {
+	return &Vault{
+		addr:   addr,
+		token:  token,
+		client: &http.Client{Timeout: defaultVaultTimeout},
+	}
+}
+
+// Fetch returns the value of the referenced key.
+func (v *Vault) Fetch(ctx context.Context, ref string) (string, error) {
+	p, key, ok := strings.Cut(ref, "#")
+	mount, p, found := strings.Cut(strings.Trim(p, "/"), "/")
+
+	if !ok || !found || key == "" || mount == "" || p == "" {
+		return "", fmt.Errorf(`invalid reference "%s", expected "<mount>/<path>#<key>"`, ref)
+	}
+
+	u := *v.addr
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/" + mount + "/data/" + p
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", v.token())
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "vault")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(`vault: unexpected "%d" code reading "%s/%s"`, resp.StatusCode, mount, p)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "vault")
+	}
+
+	value, ok := body.Data.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf(`vault: key "%s" not found in "%s/%s"`, key, mount, p)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,67 @@
+package secret_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/secret"
+	"github.com/jderusse/http-broadcast/pkg/secret/vaulttest"
+)
+
+func newVault(t *testing.T, token string) (*secret.Vault, *vaulttest.Server) {
+	server := vaulttest.NewServer("root")
+	t.Cleanup(server.Close)
+
+	addr, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	return secret.NewVault(addr, func() string { return token }), server
+}
+
+func TestVaultFetch(t *testing.T) {
+	vault, server := newVault(t, "root")
+	server.Put("secret/http-broadcast", map[string]interface{}{"publish_token": "token"})
+
+	value, err := vault.Fetch(context.Background(), "secret/http-broadcast#publish_token")
+	require.NoError(t, err)
+	assert.Equal(t, "token", value)
+
+	server.Put("secret/http-broadcast", map[string]interface{}{"publish_token": "rotated"})
+
+	value, err = vault.Fetch(context.Background(), "secret/http-broadcast#publish_token")
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", value)
+}
+
+func TestVaultFetchErrors(t *testing.T) {
+	vault, server := newVault(t, "root")
+	server.Put("secret/http-broadcast", map[string]interface{}{"publish_token": "token"})
+
+	var providerTests = []struct {
+		ref      string
+		expected string
+	}{
+		{"secret/http-broadcast", `invalid reference "secret/http-broadcast", expected "<mount>/<path>#<key>"`},
+		{"secret#key", `invalid reference "secret#key", expected "<mount>/<path>#<key>"`},
+		{"secret/http-broadcast#", `invalid reference "secret/http-broadcast#", expected "<mount>/<path>#<key>"`},
+		{"secret/missing#publish_token", `vault: unexpected "404" code reading "secret/missing"`},
+		{"secret/http-broadcast#missing", `vault: key "missing" not found in "secret/http-broadcast"`},
+	}
+
+	for _, test := range providerTests {
+		_, err := vault.Fetch(context.Background(), test.ref)
+		assert.EqualError(t, err, test.expected, test.ref)
+	}
+}
+
+func TestVaultFetchForbidden(t *testing.T) {
+	vault, server := newVault(t, "invalid")
+	server.Put("secret/http-broadcast", map[string]interface{}{"publish_token": "token"})
+
+	_, err := vault.Fetch(context.Background(), "secret/http-broadcast#publish_token")
+	assert.EqualError(t, err, `vault: unexpected "403" code reading "secret/http-broadcast"`)
+}
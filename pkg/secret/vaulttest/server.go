@@ -0,0 +1,78 @@
+// Package vaulttest provides a Vault compatible server for tests and local
+// development.
+package vaulttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server is an in memory server implementing the read API of the KV version 2
+// secrets engine of Vault.
+type Server struct {
+	*httptest.Server
+
+	token   string
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+// NewServer starts a server accepting the given token.
+func NewServer(token string) *Server {
+	s := &Server{
+		token:   token,
+		secrets: map[string]map[string]interface{}{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Put stores the data of the secret at the path, ie. `secret/http-broadcast`.
+func (s *Server) Put(path string, data map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.secrets[strings.Trim(path, "/")] = data
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != s.token {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+
+		return
+	}
+
+	mount, path, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/"), "/data/")
+	if r.Method != http.MethodGet || !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+
+		return
+	}
+
+	s.mu.Lock()
+	data, ok := s.secrets[mount+"/"+path]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"version": 1},
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
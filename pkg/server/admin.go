@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// startAdminServer starts the server exposing the operational endpoints.
+func (s *Server) startAdminServer() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	if s.status != nil {
+		mux.HandleFunc("/status/", s.handleStatus)
+		mux.HandleFunc("/agents", s.handleAgents)
+	}
+
+	s.adminServer = &http.Server{
+		Handler: mux,
+	}
+
+	ln, err := newListener(s.options.Server.AdminAddr, s.options.Server.SocketMode, s.options.Server.SocketOwner)
+	if err != nil {
+		return errors.Wrap(err, "start admin server")
+	}
+
+	log.WithFields(log.Fields{"address": s.options.Server.AdminAddr}).Info("server: admin server listening")
+
+	go func() {
+		defer ln.Close()
+		s.adminServer.Serve(ln)
+	}()
+
+	return nil
+}
+
+// handleMetrics exposes metrics using the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if s.spool != nil {
+		fmt.Fprintln(w, "# HELP http_broadcast_spool_depth Number of messages waiting in the spool to be published.")
+		fmt.Fprintln(w, "# TYPE http_broadcast_spool_depth gauge")
+		fmt.Fprintf(w, "http_broadcast_spool_depth %d\n", s.spool.Len())
+	}
+
+	if s.status != nil {
+		fmt.Fprintln(w, "# HELP http_broadcast_agents Number of live agents.")
+		fmt.Fprintln(w, "# TYPE http_broadcast_agents gauge")
+		agents := 0
+		for _, name := range s.statusScopes() {
+			store, _ := s.statusStore(name)
+			agents += len(store.Agents())
+		}
+
+		fmt.Fprintf(w, "http_broadcast_agents %d\n", agents)
+	}
+}
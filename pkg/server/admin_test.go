@@ -0,0 +1,53 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+func TestAdminMetrics(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr:      ":8008",
+			AdminAddr: ":9091",
+			Spool: config.SpoolOptions{
+				Dir: dir,
+			},
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL("http://127.0.0.1:666")},
+		},
+	})
+
+	ln, err := s.listen()
+	require.NoError(t, err)
+
+	defer ln.Close()
+	defer s.Shutdown()
+	go s.serve(ln)
+
+	resp, err := http.DefaultClient.Get("http://127.0.0.1:8008")
+	require.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err = http.DefaultClient.Get("http://127.0.0.1:9091/metrics")
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "http_broadcast_spool_depth 1\n")
+}
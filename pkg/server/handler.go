@@ -1,79 +1,262 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/server/middleware/audit"
+	"github.com/jderusse/http-broadcast/pkg/spool"
+	"github.com/jderusse/http-broadcast/pkg/tenant"
+	"github.com/jderusse/http-broadcast/pkg/tracing"
+	"github.com/jderusse/http-broadcast/pkg/transform"
 )
 
-func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
-	rStr, _ := httputil.DumpRequest(r, true)
+// IDHeader is the response header holding the ID of the broadcasted message
+const IDHeader = "X-HttpBroadcast-Id"
 
-	log.WithFields(log.Fields{"request": string(rStr)}).Debug("Server: Handling request")
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.limitBody(w, r)
 
-	request := dto.NewRequestFromHTTP(r)
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.WithFields(log.Fields{"request": s.redactor.DumpRequest(r)}).Debug("Server: Handling request")
+	}
 
-	// serializing original request
-	data, err := json.Marshal(request)
+	request, err := dto.NewRequestFromHTTP(r)
 	if err != nil {
-		log.Error(errors.Wrap(err, "encode Request"))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.rejectBody(w, r, err)
+
+		return
+	}
+
+	request.Header = s.headerPolicy.Apply(request.Header)
+
+	requests, ok := s.transformRequest(w, r, request)
+	if !ok {
+		return
+	}
+
+	s.broadcast(w, r, requests)
+}
+
+// limitBody limits the size of the body of the request.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) {
+	if s.options.Server.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.options.Server.MaxBodySize)
+	}
+}
+
+// rejectBody responds to a request which body could not be read.
+func (s *Server) rejectBody(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		log.WithFields(log.Fields{"limit": maxBytesErr.Limit}).Warn("Server: request body too large")
+		audit.Annotate(r, "", audit.ResultRejected)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
 
 		return
 	}
 
-	// building Hub Request
-	log.WithFields(log.Fields{"data": string(data), "topic": s.options.Hub.Topic, "target": s.options.Hub.Target, "hub": s.options.Hub.Endpoint}).Debug("Server: Pushing message to HUB")
+	log.Error(errors.Wrap(err, "read Request"))
+	audit.Annotate(r, "", audit.ResultFailed)
+	w.WriteHeader(http.StatusBadRequest)
+}
 
-	form := url.Values{}
-	form.Set("topic", s.options.Hub.Topic)
-	form.Set("target", s.options.Hub.Target)
-	form.Set("data", string(data))
-	formData := form.Encode()
+// transformRequest applies the transform pipeline to the request, and returns
+// the requests to broadcast. It responds to the client and returns false when
+// the request is rejected.
+func (s *Server) transformRequest(w http.ResponseWriter, r *http.Request, request *dto.Request) ([]*dto.Request, bool) {
+	if s.transform == nil {
+		return []*dto.Request{request}, true
+	}
 
-	hubRequest, _ := http.NewRequest("POST", s.options.Hub.Endpoint.String(), strings.NewReader(formData))
+	requests, err := s.transform.Apply(request)
+	if err == nil {
+		return requests, true
+	}
 
-	if s.options.Hub.PublishToken != "" {
-		hubRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.options.Hub.PublishToken))
+	var rejectErr *transform.RejectError
+	if errors.As(err, &rejectErr) {
+		log.WithFields(log.Fields{"messageID": request.ID, "status": rejectErr.Status}).Warn("Server: request rejected by transform rules")
+		audit.Annotate(r, request.ID, audit.ResultRejected)
+		http.Error(w, rejectErr.Message, rejectErr.Status)
+
+		return nil, false
 	}
 
-	hubRequest.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	hubRequest.Header.Add("Content-Length", strconv.Itoa(len(formData)))
+	log.WithFields(log.Fields{"messageID": request.ID}).Error(errors.Wrap(err, "transform Request"))
+	audit.Annotate(r, request.ID, audit.ResultFailed)
+	w.WriteHeader(http.StatusInternalServerError)
+
+	return nil, false
+}
+
+// outgoing is a request encoded and ready to be published.
+type outgoing struct {
+	ctx     context.Context
+	span    trace.Span
+	request *dto.Request
+	message hub.Message
+}
+
+// broadcast publishes the requests into the hub, or spools them when a spool
+// is configured. All the requests are encoded before publishing the first
+// one, then they are published in order and the first failure stops the
+// broadcast. The response holds the IDs of the messages published before the
+// failure, for the client to only retry the others.
+func (s *Server) broadcast(w http.ResponseWriter, r *http.Request, requests []*dto.Request) {
+	ctx := tracing.Propagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	messages := make([]*outgoing, 0, len(requests))
+
+	defer func() {
+		for _, m := range messages {
+			m.span.End()
+		}
+	}()
+
+	for _, request := range requests {
+		m, err := s.prepare(ctx, request)
+		messages = append(messages, m)
+
+		if err != nil {
+			log.WithFields(log.Fields{"messageID": request.ID}).Error(errors.Wrap(err, "encode Request"))
+			m.span.SetStatus(codes.Error, err.Error())
+			audit.Annotate(r, request.ID, audit.ResultFailed)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+	}
+
+	ids := make([]string, 0, len(messages))
+	result := audit.ResultPublished
+
+	for i, m := range messages {
+		ids = append(ids, m.request.ID)
 
-	// pushing request to hub
-	hubResponse, err := s.hubClient.Do(hubRequest)
+		var status int
+		if result, status = s.publish(m); status != 0 {
+			audit.Annotate(r, strings.Join(ids, ","), result)
+			published(w, ids[:i]...)
+			w.WriteHeader(status)
+
+			return
+		}
+	}
+
+	audit.Annotate(r, strings.Join(ids, ","), result)
+	accepted(w, ids...)
+}
+
+// prepare encodes the request into the message to publish, within a new
+// span.
+func (s *Server) prepare(ctx context.Context, request *dto.Request) (*outgoing, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "broadcast",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("http_broadcast.message_id", request.ID),
+			attribute.String("http.request.method", request.Method),
+			attribute.String("url.path", request.Path),
+		),
+	)
+
+	m := &outgoing{ctx: ctx, span: span, request: request}
+
+	request.Trace = tracing.Inject(ctx)
+
+	// serializing original request
+	data, err := s.encodeRequest(*request)
 	if err != nil {
-		log.Error(errors.Wrap(err, "push record"))
+		return m, err
 	}
 
-	if hubResponse != nil && hubResponse.StatusCode >= http.StatusBadRequest {
-		defer hubResponse.Body.Close()
-		respStr, _ := httputil.DumpResponse(hubResponse, true)
+	m.message = hub.Message{
+		ID:     request.ID,
+		Topic:  s.options.Hub.Topic,
+		Target: s.options.Hub.Target,
+		Data:   data,
+	}
 
-		log.WithFields(log.Fields{"response": string(respStr)}).Error(errors.New("invalid response from Hub"))
+	if t, ok := tenant.FromContext(ctx); ok {
+		s.route(&m.message, t)
 	}
 
-	if err != nil || hubResponse.StatusCode >= http.StatusBadRequest {
-		w.WriteHeader(http.StatusInternalServerError)
+	return m, nil
+}
+
+// publish publishes a single message. It returns the audit result and, on
+// failure, the status code to respond with.
+func (s *Server) publish(m *outgoing) (string, int) {
+	ctx, span, request, message := m.ctx, m.span, m.request, m.message
 
-		return
+	if store, ok := s.statusStoreFor(ctx); ok {
+		store.Track(request.ID)
 	}
 
-	log.WithFields(log.Fields{"request": request}).Debug("Server: message Published")
+	if s.spool != nil {
+		if err := s.spoolMessage(message); err != nil {
+			log.WithFields(log.Fields{"messageID": request.ID, "traceID": tracing.TraceID(ctx)}).Error(errors.Wrap(err, "spool record"))
+			span.SetStatus(codes.Error, err.Error())
 
-	defer hubResponse.Body.Close()
+			if err == spool.ErrFull {
+				return audit.ResultRejected, http.StatusServiceUnavailable
+			}
+
+			return audit.ResultFailed, http.StatusInternalServerError
+		}
+
+		log.WithFields(log.Fields{"messageID": request.ID, "traceID": tracing.TraceID(ctx), "request": s.redactor.Request(*request)}).Debug("Server: message spooled")
+
+		return audit.ResultSpooled, 0
+	}
+
+	if err := s.publisher.Publish(message); err != nil {
+		log.WithFields(log.Fields{"messageID": request.ID, "traceID": tracing.TraceID(ctx)}).Error(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return audit.ResultFailed, http.StatusInternalServerError
+	}
+
+	log.WithFields(log.Fields{"messageID": request.ID, "traceID": tracing.TraceID(ctx), "request": s.redactor.Request(*request)}).Debug("Server: message Published")
+
+	return audit.ResultPublished, 0
+}
+
+// encodeRequest serializes the request, compressing its body when it exceeds
+// the configured threshold.
+func (s *Server) encodeRequest(request dto.Request) ([]byte, error) {
+	options := s.options.Server.Body
+	if options.Encoding != "" && options.Encoding != dto.EncodingNone && len(request.Body) >= options.Threshold {
+		if err := request.Encode(options.Encoding); err != nil {
+			return nil, err
+		}
+	}
+
+	return dto.Marshal(request, s.options.Server.WireFormat)
+}
+
+// published adds the IDs of the published messages to the response.
+func published(w http.ResponseWriter, ids ...string) {
+	for _, id := range ids {
+		w.Header().Add(IDHeader, id)
+	}
+}
+
+func accepted(w http.ResponseWriter, ids ...string) {
+	published(w, ids...)
 
-	w.WriteHeader(http.StatusAccepted)
 	h := w.Header()
 	h.Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	h.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusAccepted)
 }
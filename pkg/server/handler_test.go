@@ -2,17 +2,28 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"regexp"
+	"sync"
 	"testing"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/transform"
 )
 
 func TestHandle(t *testing.T) {
@@ -29,7 +40,7 @@ func TestHandle(t *testing.T) {
 			Addr: ":8002",
 		},
 		Hub: config.HubOptions{
-			Endpoint:   parseSafeURL(httpServer.URL),
+			Endpoints:  []*url.URL{parseSafeURL(httpServer.URL)},
 			Topic:      "my-topic",
 			Target:     "my-target",
 			GuardToken: "-",
@@ -58,7 +69,13 @@ func TestHandle(t *testing.T) {
 
 	assert.Equal(t, "my-topic", form.Get("topic"))
 	assert.Equal(t, "my-target", form.Get("target"))
-	assert.Equal(t, `{"Method":"POST","Host":"127.0.0.1:8002","Path":"/","Header":{"Accept-Encoding":["gzip"],"Content-Length":["5"],"Content-Type":["text/plain"],"User-Agent":["Go-http-client/1.1"],"X-Forwarded-Host":["127.0.0.1:8002"],"X-Forwarded-Port":["8002"],"X-Forwarded-Proto":["http"],"X-Forwarded-Server":["`+hostname+`"],"X-Httpbroadcast-Guard":["-"],"X-Real-Ip":["127.0.0.1"]},"Body":"SGVsbG8="}`, form.Get("data"))
+
+	id := resp.Header.Get(IDHeader)
+	assert.Regexp(t, `^[0-9A-Z]{26}$`, id)
+	assert.Equal(t, id, form.Get("id"))
+
+	data := regexp.MustCompile(`^\{"ID":"[0-9A-Z]{26}",`).ReplaceAllString(form.Get("data"), "{")
+	assert.Equal(t, `{"Method":"POST","Host":"127.0.0.1:8002","Path":"/","Header":{"Accept-Encoding":["gzip"],"Content-Type":["text/plain"],"User-Agent":["Go-http-client/1.1"],"X-Forwarded-Host":["127.0.0.1:8002"],"X-Forwarded-Port":["8002"],"X-Forwarded-Proto":["http"],"X-Forwarded-Server":["`+hostname+`"],"X-Httpbroadcast-Guard":["-"],"X-Real-Ip":["127.0.0.1"]},"Body":"SGVsbG8="}`, data)
 }
 
 func TestHandleWithoutHub(t *testing.T) {
@@ -67,7 +84,7 @@ func TestHandleWithoutHub(t *testing.T) {
 			Addr: ":8003",
 		},
 		Hub: config.HubOptions{
-			Endpoint: parseSafeURL("http://127.0.0.1:666"),
+			Endpoints: []*url.URL{parseSafeURL("http://127.0.0.1:666")},
 		},
 	})
 
@@ -83,3 +100,213 @@ func TestHandleWithoutHub(t *testing.T) {
 	assert.NotNil(t, resp)
 	assert.Equal(t, 500, resp.StatusCode) // hub in not running
 }
+
+func TestHandleBodyTooLarge(t *testing.T) {
+	published := false
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		published = true
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			MaxBodySize: 4,
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	s.handle(w, httptest.NewRequest("POST", "/", bytes.NewBufferString("Hello")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.False(t, published)
+
+	// the body is limited before being dumped in debug logs
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	w = httptest.NewRecorder()
+	s.handle(w, httptest.NewRequest("POST", "/", bytes.NewBufferString("Hello")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.False(t, published)
+}
+
+func TestHandleEncodedBody(t *testing.T) {
+	var form url.Values
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.Form
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Body: config.BodyOptions{
+				Encoding:  dto.EncodingGzip,
+				Threshold: 6,
+			},
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+
+	for body, encoding := range map[string]string{"Hello": "", "Hello world": dto.EncodingGzip} {
+		w := httptest.NewRecorder()
+		s.handle(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)))
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		var request dto.Request
+		require.NoError(t, json.Unmarshal([]byte(form.Get("data")), &request))
+		assert.Equal(t, encoding, request.Encoding)
+		require.NoError(t, request.Decode(0))
+		assert.Equal(t, body, string(request.Body))
+	}
+}
+
+func TestHandleWireFormat(t *testing.T) {
+	var form url.Values
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.Form
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			WireFormat: dto.FormatMsgpack,
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	s.handle(w, httptest.NewRequest("POST", "/foo", bytes.NewBufferString("Hello")))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "2.", form.Get("data")[:2])
+
+	var request dto.Request
+	require.NoError(t, dto.Unmarshal([]byte(form.Get("data")), &request))
+	assert.Equal(t, "/foo", request.Path)
+	assert.Equal(t, "Hello", string(request.Body))
+}
+
+func TestHandleTransform(t *testing.T) {
+	var paths []string
+	var mu sync.Mutex
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		var request dto.Request
+		json.Unmarshal([]byte(r.Form.Get("data")), &request)
+		mu.Lock()
+		paths = append(paths, request.Host+request.Path)
+		mu.Unlock()
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+	s.transform, _ = transform.New([]transform.Rule{
+		{Match: transform.Match{Methods: []string{"PURGE"}}, Split: ","},
+		{Set: transform.Set{Host: "{{ .Host | lower }}"}},
+	})
+
+	w := httptest.NewRecorder()
+	s.handle(w, httptest.NewRequest("PURGE", "http://Example.COM/a,/b", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Len(t, w.Header().Values(IDHeader), 2)
+	assert.Equal(t, []string{"example.com/a", "example.com/b"}, paths)
+}
+
+func TestHandleTransformPartialFailure(t *testing.T) {
+	var paths []string
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		var request dto.Request
+		json.Unmarshal([]byte(r.Form.Get("data")), &request)
+		if request.Path == "/b" {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		paths = append(paths, request.Path)
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+	s.transform, _ = transform.New([]transform.Rule{
+		{Split: ","},
+	})
+
+	w := httptest.NewRecorder()
+	s.handle(w, httptest.NewRequest("PURGE", "/a,/b,/c", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// only the ID of the published message is returned
+	assert.Len(t, w.Header().Values(IDHeader), 1)
+	assert.Equal(t, []string{"/a"}, paths)
+}
+
+func TestHandleTransformReject(t *testing.T) {
+	s := NewServer(&config.Options{})
+	s.transform, _ = transform.New([]transform.Rule{
+		{Match: transform.Match{Path: "^/admin"}, Reject: &transform.Reject{Status: http.StatusForbidden, Message: "forbidden path"}},
+	})
+
+	w := httptest.NewRecorder()
+	s.handle(w, httptest.NewRequest("PURGE", "/admin/foo", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "forbidden path\n", w.Body.String())
+}
+
+func TestHandleTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var form url.Values
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.Form
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+
+	r := httptest.NewRequest("PURGE", "/foo", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	w := httptest.NewRecorder()
+	s.handle(w, r)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "broadcast", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+
+	var request dto.Request
+	require.NoError(t, json.Unmarshal([]byte(form.Get("data")), &request))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanContext().SpanID().String()+"-01", request.Trace["traceparent"])
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/server/middleware/audit"
+)
+
+// handleInvalidate broadcasts the cache invalidation intents described by
+// the JSON body of the request: {"urls": [...], "bans": [...], "tags": [...]}.
+func (s *Server) handleInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	s.limitBody(w, r)
+
+	var invalidation dto.Invalidation
+	if err := json.NewDecoder(r.Body).Decode(&invalidation); err != nil {
+		s.rejectBody(w, r, err)
+
+		return
+	}
+
+	if err := invalidation.Validate(); err != nil {
+		audit.Annotate(r, "", audit.ResultRejected)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	s.broadcast(w, r, []*dto.Request{dto.NewInvalidationRequest(invalidation)})
+}
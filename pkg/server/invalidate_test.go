@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestHandleInvalidate(t *testing.T) {
+	var form url.Values
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.Form
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			InvalidationPath: "/invalidate",
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+	h := s.chainHandlers()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/invalidate", bytes.NewBufferString(`{"urls":["/foo"],"bans":["^/products/"],"tags":["product-42"]}`)))
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	var request dto.Request
+	require.NoError(t, dto.Unmarshal([]byte(form.Get("data")), &request))
+	assert.Equal(t, w.Header().Get(IDHeader), request.ID)
+	assert.Equal(t, dto.InvalidationMethod, request.Method)
+	assert.Equal(t, &dto.Invalidation{
+		URLs: []string{"/foo"},
+		Bans: []string{"^/products/"},
+		Tags: []string{"product-42"},
+	}, request.Invalidation)
+}
+
+func TestHandleInvalidateInvalid(t *testing.T) {
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			InvalidationPath: "/invalidate",
+		},
+	})
+	h := s.chainHandlers()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/invalidate", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "POST", w.Header().Get("Allow"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/invalidate", bytes.NewBufferString(`{"urls":`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/invalidate", bytes.NewBufferString(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "empty invalidation\n", w.Body.String())
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const unixPrefix = "unix:"
+
+// newListener listens on the given address. Addresses prefixed by `unix:`
+// are unix domain sockets, other addresses are TCP.
+func newListener(addr string, mode os.FileMode, owner string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, unixPrefix)
+
+	// remove the socket left by a previous process
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "remove stale socket")
+		}
+	}
+
+	// the socket is created in a private directory, and moved to its path
+	// once its mode and owner are applied, so that nobody can connect to it
+	// in between
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".http-broadcast-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create socket directory")
+	}
+
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, "socket")
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	ln.SetUnlinkOnClose(false)
+
+	if err := setupSocket(tmpPath, mode, owner); err != nil {
+		ln.Close()
+
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		ln.Close()
+
+		return nil, errors.Wrap(err, "move socket")
+	}
+
+	return &unixListener{UnixListener: ln, path: path, unlink: true}, nil
+}
+
+// setupSocket applies the mode and the owner to the socket.
+func setupSocket(path string, mode os.FileMode, owner string) error {
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return errors.Wrap(err, "change socket mode")
+		}
+	}
+
+	if owner != "" {
+		uid, gid, err := lookupOwner(owner)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Chown(path, uid, gid); err != nil {
+			return errors.Wrap(err, "change socket owner")
+		}
+	}
+
+	return nil
+}
+
+// unixListener is a unix socket listener moved to path after being created.
+type unixListener struct {
+	*net.UnixListener
+	path   string
+	unlink bool
+}
+
+// Addr returns the path of the socket.
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// SetUnlinkOnClose sets whether the socket file should be removed when the
+// listener is closed.
+func (l *unixListener) SetUnlinkOnClose(unlink bool) {
+	l.unlink = unlink
+}
+
+// Close stops listening, and removes the socket file.
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+
+	if l.unlink {
+		os.Remove(l.path)
+	}
+
+	return err
+}
+
+// lookupOwner resolves an owner formatted as `user[:group]` where user and
+// group are either names or numeric ids.
+func lookupOwner(owner string) (int, int, error) {
+	parts := strings.SplitN(owner, ":", 2)
+	uid, gid := -1, -1
+
+	if parts[0] != "" {
+		id := parts[0]
+		if _, err := strconv.Atoi(id); err != nil {
+			u, err := user.Lookup(id)
+			if err != nil {
+				return 0, 0, errors.Wrap(err, "lookup socket owner")
+			}
+
+			id = u.Uid
+		}
+
+		uid, _ = strconv.Atoi(id)
+	}
+
+	if len(parts) == 2 && parts[1] != "" {
+		id := parts[1]
+		if _, err := strconv.Atoi(id); err != nil {
+			g, err := user.LookupGroup(id)
+			if err != nil {
+				return 0, 0, errors.Wrap(err, "lookup socket group")
+			}
+
+			id = g.Gid
+		}
+
+		gid, _ = strconv.Atoi(id)
+	}
+
+	return uid, gid, nil
+}
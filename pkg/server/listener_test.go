@@ -0,0 +1,84 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewListenerTCP(t *testing.T) {
+	ln, err := newListener("127.0.0.1:0", 0, "")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	assert.Equal(t, "tcp", ln.Addr().Network())
+}
+
+func TestNewListenerUnix(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "server.sock")
+
+	ln, err := newListener("unix:"+socket, 0600, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, "unix", ln.Addr().Network())
+
+	fi, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	assert.Equal(t, socket, ln.Addr().String())
+
+	// the private directory used to create the socket is removed
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	conn, err := net.Dial("unix", socket)
+	require.NoError(t, err)
+	conn.Close()
+
+	// simulate a crash which leaves the socket file behind
+	ln.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = newListener("unix:"+socket, 0, "")
+	require.NoError(t, err)
+	ln.Close()
+
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLookupOwner(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+
+	u, g, err := lookupOwner(current.Username)
+	require.NoError(t, err)
+	assert.Equal(t, uid, u)
+	assert.Equal(t, -1, g)
+
+	u, g, err = lookupOwner(current.Uid + ":" + current.Gid)
+	require.NoError(t, err)
+	assert.Equal(t, uid, u)
+	assert.Equal(t, gid, g)
+
+	u, g, err = lookupOwner(":" + current.Gid)
+	require.NoError(t, err)
+	assert.Equal(t, -1, u)
+	assert.Equal(t, gid, g)
+
+	_, _, err = lookupOwner("does-not-exists")
+	assert.Error(t, err)
+}
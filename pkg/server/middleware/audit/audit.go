@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/redact"
+)
+
+// Results of a broadcast
+const (
+	ResultPublished = "published"
+	ResultSpooled   = "spooled"
+	ResultRejected  = "rejected"
+	ResultFailed    = "failed"
+)
+
+const xRealIP = "X-Real-Ip"
+
+type recordKey struct{}
+
+// record holds the information provided by the handler about a broadcast.
+type record struct {
+	messageID string
+	result    string
+}
+
+// Annotate attaches the ID of the broadcasted message and the result of the
+// broadcast to the audit record of the request.
+func Annotate(r *http.Request, messageID string, result string) {
+	if rec, ok := r.Context().Value(recordKey{}).(*record); ok {
+		rec.messageID = messageID
+		rec.result = result
+	}
+}
+
+// Audit is an HTTP handler wrapper that writes a structured record of each
+// broadcast: who broadcasted what, and what happened.
+type Audit struct {
+	logger   *log.Logger
+	headers  bool
+	redactor *redact.Redactor
+	next     http.Handler
+}
+
+func (a *Audit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &record{}
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+	a.next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)))
+
+	fields := log.Fields{
+		"clientIP":  clientIP(r),
+		"identity":  Identity(r),
+		"method":    r.Method,
+		"host":      r.Host,
+		"path":      r.URL.Path,
+		"messageID": rec.messageID,
+		"result":    rec.result,
+		"status":    sw.status,
+		"duration":  time.Since(start).String(),
+	}
+
+	if a.headers {
+		fields["headers"] = a.redactor.Header(r.Header)
+	}
+
+	a.logger.WithFields(fields).Info("audit")
+}
+
+// Identity returns the identity of the client: the common name of its TLS
+// certificate, or the user of its basic authentication.
+func Identity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+
+	return ""
+}
+
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get(xRealIP); ip != "" {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// NewAudit allocates and returns a new Audit writing records with the
+// formatter of the standard logger.
+func NewAudit(options config.AuditOptions, redactor *redact.Redactor, next http.Handler) *Audit {
+	logger := log.New()
+	logger.SetFormatter(log.StandardLogger().Formatter)
+	logger.SetOutput(newOutput(options))
+
+	return &Audit{
+		logger:   logger,
+		headers:  options.Headers,
+		redactor: redactor,
+		next:     next,
+	}
+}
+
+func newOutput(options config.AuditOptions) io.Writer {
+	switch options.Output {
+	case "stderr":
+		return os.Stderr
+	case "stdout":
+		return os.Stdout
+	}
+
+	return &lumberjack.Logger{
+		Filename:   options.Output,
+		MaxSize:    options.MaxSize,
+		MaxBackups: options.MaxBackups,
+		MaxAge:     options.MaxAge,
+	}
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/redact"
+)
+
+func TestServeHTTP(t *testing.T) {
+	var buf bytes.Buffer
+
+	redactor := redact.New(config.LogOptions{RedactHeaders: []string{"Authorization", "Cookie"}})
+	a := NewAudit(config.AuditOptions{Output: "stderr", Headers: true}, redactor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Annotate(r, "my-id", ResultPublished)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	a.logger.SetFormatter(&log.JSONFormatter{})
+	a.logger.SetOutput(&buf)
+
+	r := httptest.NewRequest("PURGE", "http://example.com/foo", nil)
+	r.SetBasicAuth("alice", "secret")
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("X-Real-Ip", "1.2.3.4")
+	r.Header.Set("X-Custom", "value")
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "audit", entry["msg"])
+	assert.Equal(t, "1.2.3.4", entry["clientIP"])
+	assert.Equal(t, "alice", entry["identity"])
+	assert.Equal(t, "PURGE", entry["method"])
+	assert.Equal(t, "example.com", entry["host"])
+	assert.Equal(t, "/foo", entry["path"])
+	assert.Equal(t, "my-id", entry["messageID"])
+	assert.Equal(t, ResultPublished, entry["result"])
+	assert.Equal(t, float64(http.StatusAccepted), entry["status"])
+	assert.Equal(t, map[string]interface{}{
+		"Authorization": []interface{}{redact.Placeholder},
+		"Cookie":        []interface{}{redact.Placeholder},
+		"X-Custom":      []interface{}{"value"},
+		"X-Real-Ip":     []interface{}{"1.2.3.4"},
+	}, entry["headers"])
+	assert.Equal(t, "session=secret", r.Header.Get("Cookie"))
+}
+
+func TestServeHTTPWithoutHeaders(t *testing.T) {
+	var buf bytes.Buffer
+
+	a := NewAudit(config.AuditOptions{Output: "stderr"}, redact.New(config.LogOptions{}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	a.logger.SetFormatter(&log.JSONFormatter{})
+	a.logger.SetOutput(&buf)
+
+	r := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	r.RemoteAddr = "5.6.7.8:1234"
+	a.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "5.6.7.8", entry["clientIP"])
+	assert.Equal(t, "", entry["messageID"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.NotContains(t, entry, "headers")
+}
+
+func TestIdentity(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	assert.Equal(t, "", Identity(r))
+
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "client.example.com"}}}}
+	assert.Equal(t, "client.example.com", Identity(r))
+}
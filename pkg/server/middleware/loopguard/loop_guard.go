@@ -5,10 +5,12 @@ import (
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
 )
 
 const (
-	guardHeader = "X-HttpBroadcast-Guard"
+	guardHeader = dto.GuardHeader
 )
 
 // LoopGuard is an HTTP handler wrapper that prevent infinite http requests
@@ -14,17 +14,40 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/headerpolicy"
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/redact"
+	"github.com/jderusse/http-broadcast/pkg/server/middleware/audit"
 	"github.com/jderusse/http-broadcast/pkg/server/middleware/forwardedheaders"
 	"github.com/jderusse/http-broadcast/pkg/server/middleware/loopguard"
+	"github.com/jderusse/http-broadcast/pkg/spool"
+	"github.com/jderusse/http-broadcast/pkg/status"
 	"github.com/jderusse/http-broadcast/pkg/sync/atomic"
+	"github.com/jderusse/http-broadcast/pkg/tenant"
+	"github.com/jderusse/http-broadcast/pkg/token"
+	"github.com/jderusse/http-broadcast/pkg/transform"
 )
 
 // Server listen for incoming request and push them into the hub.
 type Server struct {
-	httpServer *http.Server
-	acmeServer *http.Server
-	hubClient  *http.Client
-	options    *config.Options
+	httpServer   *http.Server
+	acmeServer   *http.Server
+	adminServer  *http.Server
+	publisher    *hub.Publisher
+	spool        *spool.Spool
+	status       *status.Store
+	tenantStatus map[string]*status.Store
+	redactor     *redact.Redactor
+	headerPolicy *headerpolicy.Policy
+	transform    *transform.Pipeline
+	tenants      *tenant.Registry
+	tenantTokens map[string]token.Provider
+
+	subscribeToken token.Provider
+	options        *config.Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	inShutdown atomic.Bool
 	mu         sync.Mutex
@@ -81,11 +104,50 @@ func (s *Server) listen() (net.Listener, error) {
 		s.Shutdown()
 	})
 
-	ln, err := net.Listen("tcp", s.options.Server.Addr)
+	if s.options.Server.TransformRules != "" {
+		pipeline, err := transform.Load(s.options.Server.TransformRules)
+		if err != nil {
+			return nil, errors.Wrap(err, "server: load transform rules")
+		}
+
+		s.transform = pipeline
+	}
+
+	if s.options.Server.Tenants != "" {
+		registry, err := tenant.Load(s.options.Server.Tenants, s.options.Hub.Topic)
+		if err != nil {
+			return nil, errors.Wrap(err, "server: load tenants")
+		}
+
+		s.tenants = registry
+		s.initTenantStatus()
+	}
+
+	if err := s.initTokens(); err != nil {
+		return nil, errors.Wrap(err, "server: create tokens")
+	}
+
+	if s.options.Server.Spool.Dir != "" {
+		if err := s.startSpool(s.ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.options.Server.AdminAddr != "" {
+		if err := s.startAdminServer(); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := newListener(s.options.Server.Addr, s.options.Server.SocketMode, s.options.Server.SocketOwner)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.status != nil {
+		s.startStatus(s.ctx)
+	}
+
 	log.WithFields(log.Fields{"address": s.options.Server.Addr, "protocol": "http"}).Info("server: listening")
 
 	return ln, nil
@@ -166,9 +228,17 @@ func (s *Server) servePlain(ln net.Listener) error {
 func (s *Server) chainHandlers() http.Handler {
 	var h http.Handler
 	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.options.Server.InvalidationPath != "" && r.URL.Path == s.options.Server.InvalidationPath {
+			s.handleInvalidate(w, r)
+
+			return
+		}
+
 		s.handle(w, r)
 	})
 
+	h = s.authenticate(h)
+
 	h = loopguard.NewLoopGuard(s.options.Hub.GuardToken, h)
 
 	if len(s.options.Server.CorsAllowedOrigins) > 0 {
@@ -188,7 +258,13 @@ func (s *Server) chainHandlers() http.Handler {
 		BrowserXssFilter:      true,
 		ContentSecurityPolicy: "default-src 'self'",
 	}).Handler(h)
-	h = handlers.CombinedLoggingHandler(os.Stderr, h)
+
+	if s.options.Server.Audit.Output != "" {
+		h = audit.NewAudit(s.options.Server.Audit, s.redactor, h)
+	} else {
+		h = handlers.CombinedLoggingHandler(os.Stderr, h)
+	}
+
 	h = handlers.RecoveryHandler(
 		handlers.RecoveryLogger(log.New()),
 		handlers.PrintRecoveryStack(s.options.Debug),
@@ -230,19 +306,36 @@ func (s *Server) Shutdown() error {
 }
 
 func (s *Server) closeHTTPServerLocked() error {
+	s.cancel()
+	s.saveStatus()
+
 	if s.acmeServer != nil {
 		s.acmeServer.Shutdown(context.Background())
 	}
 
+	if s.adminServer != nil {
+		s.adminServer.Shutdown(context.Background())
+	}
+
 	return s.httpServer.Shutdown(context.Background())
 }
 
 // NewServer allocates and returns a new Server.
 func NewServer(options *config.Options) *Server {
-	return &Server{
-		options: options,
-		hubClient: &http.Client{
-			Timeout: options.Hub.Timeout,
-		},
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		options:      options,
+		publisher:    hub.NewPublisher(options.Hub),
+		redactor:     redact.New(options.Log),
+		headerPolicy: headerpolicy.New(options.Server.Headers),
+		ctx:          ctx,
+		cancel:       cancel,
 	}
+
+	if options.Hub.StatusTopic != "" {
+		s.status = status.NewStore(options.Server.Status.MaxSize, options.Server.Status.AgentTTL)
+	}
+
+	return s
 }
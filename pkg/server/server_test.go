@@ -22,7 +22,7 @@ func TestServe(t *testing.T) {
 			Addr: ":8004",
 		},
 		Hub: config.HubOptions{
-			Endpoint: parseSafeURL("http://127.0.0.1:1234"),
+			Endpoints: []*url.URL{parseSafeURL("http://127.0.0.1:1234")},
 		},
 	})
 
@@ -48,7 +48,7 @@ func TestAcme(t *testing.T) {
 			},
 		},
 		Hub: config.HubOptions{
-			Endpoint: parseSafeURL("http://127.0.0.1:1234"),
+			Endpoints: []*url.URL{parseSafeURL("http://127.0.0.1:1234")},
 		},
 	})
 
@@ -85,7 +85,7 @@ func TestShutdown(t *testing.T) {
 			Addr: ":8006",
 		},
 		Hub: config.HubOptions{
-			Endpoint: parseSafeURL("http://127.0.0.1:1234"),
+			Endpoints: []*url.URL{parseSafeURL("http://127.0.0.1:1234")},
 		},
 	})
 
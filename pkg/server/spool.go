@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/spool"
+)
+
+const defaultMaxInterval = 5 * time.Second
+
+// startSpool opens the spool and starts publishing its messages in the
+// background.
+func (s *Server) startSpool(ctx context.Context) error {
+	sp, err := spool.Open(s.options.Server.Spool.Dir, s.options.Server.Spool.MaxSize)
+	if err != nil {
+		return err
+	}
+
+	s.spool = sp
+
+	log.WithFields(log.Fields{"dir": s.options.Server.Spool.Dir, "depth": sp.Len()}).Info("server: spool opened")
+
+	go s.flushSpool(ctx)
+
+	return nil
+}
+
+// spoolMessage stores the message in the spool.
+func (s *Server) spoolMessage(m hub.Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return s.spool.Push(data)
+}
+
+// flushSpool publishes the spooled messages one by one, in order, retrying
+// each message until it succeeds or the context is canceled. Messages
+// permanently rejected by the hub are moved aside, to not block the following
+// ones.
+func (s *Server) flushSpool(ctx context.Context) {
+	for {
+		data, err := s.spool.Next(ctx)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return
+		}
+
+		var m hub.Message
+		if err == nil {
+			err = json.Unmarshal(data, &m)
+		}
+
+		if err != nil {
+			log.Error(errors.Wrap(err, "read spooled record, skipping"))
+			s.spool.Ack()
+
+			continue
+		}
+
+		// tokens are not stored in the spool
+		if s.tenants != nil {
+			if t, ok := s.tenants.ByTopic(m.Topic); ok {
+				s.route(&m, t)
+			}
+		}
+
+		retry := backoff.NewExponentialBackOff()
+		retry.MaxInterval = defaultMaxInterval
+		retry.MaxElapsedTime = 0
+
+		err = backoff.RetryNotify(func() error {
+			if err := s.publisher.Publish(m); err != nil {
+				if hub.IsPermanent(err) {
+					return backoff.Permanent(err)
+				}
+
+				return err
+			}
+
+			return nil
+		}, backoff.WithContext(retry, ctx), func(err error, d time.Duration) {
+			log.WithFields(log.Fields{"depth": s.spool.Len()}).Warn(err)
+		})
+		if hub.IsPermanent(err) {
+			log.WithFields(log.Fields{"messageID": m.ID}).Error(errors.Wrap(err, "publish spooled record, rejecting"))
+
+			if err := s.spool.Reject(); err != nil {
+				log.Error(err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			// the context has been canceled, the message will be
+			// published on next start
+			return
+		}
+
+		if err := s.spool.Ack(); err != nil {
+			log.Error(err)
+		}
+
+		log.WithFields(log.Fields{"messageID": m.ID, "depth": s.spool.Len()}).Debug("Server: spooled message Published")
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+func TestHandleWithSpool(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	var hubUp int32
+	var hubBodies atomic.Value
+	hubBodies.Store([]string{})
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&hubUp) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+		hubBodies.Store(append(hubBodies.Load().([]string), form.Get("data")))
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr: ":8007",
+			Spool: config.SpoolOptions{
+				Dir:     dir,
+				MaxSize: 2,
+			},
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+
+	ln, err := s.listen()
+	require.NoError(t, err)
+
+	defer ln.Close()
+	defer s.Shutdown()
+	go s.serve(ln)
+
+	for _, path := range []string{"/foo", "/bar"} {
+		resp, err := http.DefaultClient.Post("http://127.0.0.1:8007"+path, "text/plain", bytes.NewBuffer([]byte("Hello")))
+		require.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode)
+	}
+
+	// spool is full
+	resp, err := http.DefaultClient.Post("http://127.0.0.1:8007/baz", "text/plain", bytes.NewBuffer([]byte("Hello")))
+	require.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 2, s.spool.Len())
+
+	atomic.StoreInt32(&hubUp, 1)
+
+	require.Eventually(t, func() bool {
+		return s.spool.Len() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	bodies := hubBodies.Load().([]string)
+	require.Len(t, bodies, 2)
+	assert.Contains(t, bodies[0], `"Path":"/foo"`)
+	assert.Contains(t, bodies[1], `"Path":"/bar"`)
+}
+
+func TestSpoolRejectedMessage(t *testing.T) {
+	dir := t.TempDir()
+
+	var hubBodies atomic.Value
+	hubBodies.Store([]string{})
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+
+		// the hub refuses the first message
+		if bytes.Contains([]byte(form.Get("data")), []byte(`"Path":"/forbidden"`)) {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		hubBodies.Store(append(hubBodies.Load().([]string), form.Get("data")))
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr: ":8014",
+			Spool: config.SpoolOptions{
+				Dir: dir,
+			},
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+		},
+	})
+
+	ln, err := s.listen()
+	require.NoError(t, err)
+
+	defer ln.Close()
+	defer s.Shutdown()
+	go s.serve(ln)
+
+	for _, path := range []string{"/forbidden", "/bar"} {
+		resp, err := http.DefaultClient.Post("http://127.0.0.1:8014"+path, "text/plain", bytes.NewBuffer([]byte("Hello")))
+		require.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode)
+	}
+
+	// the rejected message does not block the next one
+	require.Eventually(t, func() bool {
+		return len(hubBodies.Load().([]string)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Contains(t, hubBodies.Load().([]string)[0], `"Path":"/bar"`)
+	assert.Equal(t, 0, s.spool.Len())
+
+	rejected, err := ioutil.ReadDir(filepath.Join(dir, "rejected"))
+	require.NoError(t, err)
+	assert.Len(t, rejected, 1)
+}
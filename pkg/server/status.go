@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/r3labs/sse"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/status"
+	"github.com/jderusse/http-broadcast/pkg/tenant"
+)
+
+// initTenantStatus creates a status store for each tenant: the agents of a
+// tenant publish their status into the status topic of their tenant.
+func (s *Server) initTenantStatus() {
+	if s.status == nil || s.tenants == nil {
+		return
+	}
+
+	s.tenantStatus = map[string]*status.Store{}
+
+	for _, t := range s.tenants.Tenants() {
+		s.tenantStatus[t.Name] = status.NewStore(s.options.Server.Status.MaxSize, s.options.Server.Status.AgentTTL)
+	}
+}
+
+// statusStore returns the status store of the tenant, or the store of the
+// messages without tenant when name is empty.
+func (s *Server) statusStore(name string) (*status.Store, bool) {
+	if name == "" {
+		return s.status, s.status != nil
+	}
+
+	store, ok := s.tenantStatus[name]
+
+	return store, ok
+}
+
+// statusStoreFor returns the status store of the tenant stored in the
+// context, if any.
+func (s *Server) statusStoreFor(ctx context.Context) (*status.Store, bool) {
+	if t, ok := tenant.FromContext(ctx); ok {
+		return s.statusStore(t.Name)
+	}
+
+	return s.statusStore("")
+}
+
+// statusScopes returns the names of the tenants having a status store, and the
+// empty name of the messages without tenant, sorted.
+func (s *Server) statusScopes() []string {
+	names := []string{""}
+	for name := range s.tenantStatus {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// statusTopic returns the status topic of the tenant.
+func (s *Server) statusTopic(name string) string {
+	if name == "" {
+		return s.options.Hub.StatusTopic
+	}
+
+	return tenant.Topic(s.options.Hub.StatusTopic, name)
+}
+
+// statusFile returns the file storing the status of the tenant.
+func (s *Server) statusFile(name string) string {
+	if name == "" || s.options.Server.Status.File == "" {
+		return s.options.Server.Status.File
+	}
+
+	return s.options.Server.Status.File + "." + name
+}
+
+// startStatus subscribes to the status topics of each hub, and aggregates
+// the events sent by agents into the status stores. Subscriptions run in the
+// background: an unreachable hub must not prevent the server from accepting
+// requests.
+func (s *Server) startStatus(ctx context.Context) {
+	for _, name := range s.statusScopes() {
+		store, _ := s.statusStore(name)
+
+		if file := s.statusFile(name); file != "" {
+			if err := store.Load(file); err != nil {
+				log.Warn(errors.Wrap(err, "server: load status"))
+			}
+		}
+
+		for _, endpoint := range s.options.Hub.Endpoints {
+			subscription := hub.Subscription{
+				Endpoint: endpoint,
+				Topic:    s.statusTopic(name),
+				Token:    s.subscribeToken,
+			}
+
+			go s.subscribeStatus(ctx, store, subscription)
+		}
+	}
+}
+
+// subscribeStatus waits for the subscription to the hub, then collects the
+// events into the store.
+func (s *Server) subscribeStatus(ctx context.Context, store *status.Store, subscription hub.Subscription) {
+	events := make(chan *sse.Event)
+	if err := hub.Subscribe(ctx, subscription, events); err != nil {
+		if ctx.Err() == nil {
+			log.WithFields(log.Fields{"hub": subscription.URL()}).Error(errors.Wrap(err, "subscribe to status"))
+		}
+
+		return
+	}
+
+	log.WithFields(log.Fields{"hub": subscription.URL()}).Info("server: collecting status")
+
+	s.collectStatus(ctx, store, events)
+}
+
+// collectStatus records the events received from a hub into the store.
+func (s *Server) collectStatus(ctx context.Context, store *status.Store, events chan *sse.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if event == nil || len(event.Data) == 0 {
+				continue
+			}
+
+			var status dto.Status
+			if err := json.Unmarshal(event.Data, &status); err != nil {
+				log.Warn(errors.Wrap(err, "parse status"))
+
+				continue
+			}
+
+			if status.Ack != nil {
+				store.Ack(*status.Ack)
+			}
+
+			if status.Heartbeat != nil {
+				store.Heartbeat(*status.Heartbeat)
+			}
+		}
+	}
+}
+
+// saveStatus stores the content of the status stores in the status files.
+func (s *Server) saveStatus() {
+	if s.status == nil || s.options.Server.Status.File == "" {
+		return
+	}
+
+	for _, name := range s.statusScopes() {
+		store, _ := s.statusStore(name)
+		if err := store.Save(s.statusFile(name)); err != nil {
+			log.Error(errors.Wrap(err, "server: save status"))
+		}
+	}
+}
+
+// handleStatus returns the delivery report of the message which ID is
+// given in the path. The messages of a tenant are only reported when the
+// tenant is given in the `tenant` query parameter.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/status/")
+
+	store, ok := s.statusStore(r.URL.Query().Get("tenant"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	report, ok := store.Get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleAgents lists the live agents with their last heartbeat. The agents of
+// a tenant are only listed when the tenant is given in the `tenant` query
+// parameter.
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.statusStore(r.URL.Query().Get("tenant"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(store.Agents())
+}
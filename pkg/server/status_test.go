@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/r3labs/sse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/dto"
+	"github.com/jderusse/http-broadcast/pkg/status"
+	"github.com/jderusse/http-broadcast/pkg/tenant"
+)
+
+func TestHandleStatus(t *testing.T) {
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Status: config.StatusOptions{
+				MaxSize:  10,
+				AgentTTL: time.Minute,
+			},
+		},
+		Hub: config.HubOptions{
+			StatusTopic: "status-topic",
+		},
+	})
+	require.NotNil(t, s.status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *sse.Event)
+	go s.collectStatus(ctx, s.status, events)
+
+	now, _ := time.Now().MarshalJSON()
+	events <- &sse.Event{Data: []byte(`{"Heartbeat":{"Agent":"agent-1","Time":` + string(now) + `}}`)}
+	events <- &sse.Event{Data: []byte(`{"Heartbeat":{"Agent":"agent-2","Time":` + string(now) + `}}`)}
+	events <- &sse.Event{Data: []byte(`{"Ack":{"MessageID":"foo","Agent":"agent-1","Success":true,"StatusCode":200,"Time":` + string(now) + `}}`)}
+	events <- &sse.Event{Data: []byte(`invalid`)}
+
+	w := httptest.NewRecorder()
+	s.handleStatus(w, httptest.NewRequest("GET", "/status/foo", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var report status.Report
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, "foo", report.ID)
+	assert.False(t, report.Complete)
+	assert.Equal(t, status.StateSuccess, report.Agents["agent-1"].State)
+	assert.Equal(t, status.StatePending, report.Agents["agent-2"].State)
+
+	w = httptest.NewRecorder()
+	s.handleStatus(w, httptest.NewRequest("GET", "/status/bar", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleStatusTenants(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Hub: config.HubOptions{
+			Endpoints:   []*url.URL{parseSafeURL(httpServer.URL)},
+			Topic:       "https://example.com/purge",
+			StatusTopic: "https://example.com/status",
+		},
+	})
+	s.tenants, _ = tenant.New(map[string]*tenant.Tenant{"brand-a": {}, "brand-b": {}}, "https://example.com/purge")
+	s.initTenantStatus()
+
+	assert.Equal(t, []string{"", "brand-a", "brand-b"}, s.statusScopes())
+	assert.Equal(t, "https://example.com/status/brand-a", s.statusTopic("brand-a"))
+
+	ta, _ := s.tenants.ByTopic("https://example.com/purge/brand-a")
+	r := httptest.NewRequest("PURGE", "/foo", nil)
+
+	w := httptest.NewRecorder()
+	s.handle(w, r.WithContext(tenant.NewContext(r.Context(), ta)))
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	id := w.Header().Get(IDHeader)
+
+	// the message is only reported to its tenant
+	for query, code := range map[string]int{
+		"":                http.StatusNotFound,
+		"?tenant=brand-b": http.StatusNotFound,
+		"?tenant=unknown": http.StatusNotFound,
+		"?tenant=brand-a": http.StatusOK,
+	} {
+		w = httptest.NewRecorder()
+		s.handleStatus(w, httptest.NewRequest("GET", "/status/"+id+query, nil))
+		assert.Equal(t, code, w.Code, query)
+	}
+
+	// acks of a tenant only reach the store of the tenant
+	storeA, _ := s.statusStore("brand-a")
+	storeA.Heartbeat(dto.Heartbeat{Agent: "agent-a", Time: time.Now()})
+
+	w = httptest.NewRecorder()
+	s.handleAgents(w, httptest.NewRequest("GET", "/agents", nil))
+	assert.Equal(t, "[]\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	s.handleAgents(w, httptest.NewRequest("GET", "/agents?tenant=brand-a", nil))
+
+	var agents []dto.Heartbeat
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&agents))
+	require.Len(t, agents, 1)
+	assert.Equal(t, "agent-a", agents[0].Agent)
+}
+
+func TestHandleAgents(t *testing.T) {
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Status: config.StatusOptions{
+				AgentTTL: time.Minute,
+			},
+		},
+		Hub: config.HubOptions{
+			StatusTopic: "status-topic",
+		},
+	})
+
+	s.status.Heartbeat(dto.Heartbeat{Agent: "agent-2", Version: "1.0.0", Pending: 2, Lag: time.Second, Time: time.Now()})
+	s.status.Heartbeat(dto.Heartbeat{Agent: "agent-1", Time: time.Now()})
+	s.status.Heartbeat(dto.Heartbeat{Agent: "agent-3", Time: time.Now().Add(-2 * time.Minute)})
+
+	w := httptest.NewRecorder()
+	s.handleAgents(w, httptest.NewRequest("GET", "/agents", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var agents []dto.Heartbeat
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&agents))
+	require.Len(t, agents, 2)
+	assert.Equal(t, "agent-1", agents[0].Agent)
+	assert.Equal(t, "agent-2", agents[1].Agent)
+	assert.Equal(t, "1.0.0", agents[1].Version)
+	assert.Equal(t, 2, agents[1].Pending)
+	assert.Equal(t, time.Second, agents[1].Lag)
+}
+
+func TestListenWithUnreachableStatusHub(t *testing.T) {
+	// reserve a port nobody listens on
+	hubLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	hubLn.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr: ":8015",
+			Spool: config.SpoolOptions{
+				Dir: t.TempDir(),
+			},
+			Status: config.StatusOptions{
+				MaxSize:  10,
+				AgentTTL: time.Minute,
+			},
+		},
+		Hub: config.HubOptions{
+			Endpoints:   []*url.URL{parseSafeURL("http://" + hubLn.Addr().String())},
+			StatusTopic: "status-topic",
+		},
+	})
+
+	listened := make(chan net.Listener)
+	go func() {
+		ln, err := s.listen()
+		assert.NoError(t, err)
+		listened <- ln
+	}()
+
+	var ln net.Listener
+	select {
+	case ln = <-listened:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server blocked by the status subscription")
+	}
+
+	defer ln.Close()
+	go s.serve(ln)
+
+	resp, err := http.DefaultClient.Post("http://127.0.0.1:8015/foo", "text/plain", bytes.NewBufferString("Hello"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Shutdown()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jderusse/http-broadcast/pkg/hub"
+	"github.com/jderusse/http-broadcast/pkg/server/middleware/audit"
+	"github.com/jderusse/http-broadcast/pkg/tenant"
+)
+
+// authenticate resolves the tenant of the client from the credentials of its
+// basic authentication, and rejects the clients which do not belong to any
+// tenant.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tenants == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		user, password, ok := r.BasicAuth()
+		t, authenticated := s.tenants.Authenticate(user, password)
+
+		if !ok || !authenticated {
+			log.WithFields(log.Fields{"user": user}).Warn("Server: authentication failed")
+			audit.Annotate(r, "", audit.ResultRejected)
+			w.Header().Set("WWW-Authenticate", `Basic realm="http-broadcast"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), t)))
+	})
+}
+
+// route sets the topic and the token of the message according to the tenant
+// owning it. Tenants without token use the token of the publisher.
+func (s *Server) route(m *hub.Message, t *tenant.Tenant) {
+	m.Topic = t.Topic
+	m.Token = s.tenantTokens[t.Name]
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+type hubRecord struct {
+	topic         string
+	authorization string
+}
+
+func TestHandleTenants(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	file := filepath.Join(dir, "tenants.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{
+		"brand-a": {"users": {"cms-a": "`+string(hash)+`"}, "publish_token": "token-a"},
+		"brand-b": {"users": {"cms-b": "`+string(hash)+`"}, "topic": "https://example.com/b"}
+	}`), 0600))
+
+	var records []hubRecord
+	var mu sync.Mutex
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+		mu.Lock()
+		records = append(records, hubRecord{form.Get("topic"), r.Header.Get("Authorization")})
+		mu.Unlock()
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr:    ":8009",
+			Tenants: file,
+		},
+		Hub: config.HubOptions{
+			Endpoints:    []*url.URL{parseSafeURL(httpServer.URL)},
+			Topic:        "https://example.com/purge",
+			PublishToken: "token",
+		},
+	})
+
+	ln, err := s.listen()
+	require.NoError(t, err)
+
+	defer ln.Close()
+	defer s.Shutdown()
+	go s.serve(ln)
+
+	cases := map[string]struct {
+		user     string
+		password string
+		status   int
+	}{
+		"anonymous": {"", "", http.StatusUnauthorized},
+		"unknown":   {"cms-c", "secret", http.StatusUnauthorized},
+		"invalid":   {"cms-a", "invalid", http.StatusUnauthorized},
+		"brand-a":   {"cms-a", "secret", http.StatusAccepted},
+		"brand-b":   {"cms-b", "secret", http.StatusAccepted},
+	}
+
+	for _, name := range []string{"anonymous", "unknown", "invalid", "brand-a", "brand-b"} {
+		c := cases[name]
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest("PURGE", "http://127.0.0.1:8009/foo", nil)
+			if c.user != "" {
+				req.SetBasicAuth(c.user, c.password)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			assert.Equal(t, c.status, resp.StatusCode)
+
+			if c.status == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="http-broadcast"`, resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	assert.Equal(t, []hubRecord{
+		{"https://example.com/purge/brand-a", "Bearer token-a"},
+		{"https://example.com/b", "Bearer token"},
+	}, records)
+}
+
+func TestHandleTenantsWithSpool(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	file := filepath.Join(dir, "tenants.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"brand-a": {"users": {"cms-a": "`+string(hash)+`"}, "publish_token": "token-a"}}`), 0600))
+
+	records := make(chan hubRecord, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+		records <- hubRecord{form.Get("topic"), r.Header.Get("Authorization")}
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr:    ":8010",
+			Tenants: file,
+			Spool: config.SpoolOptions{
+				Dir:     filepath.Join(dir, "spool"),
+				MaxSize: 10,
+			},
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+			Topic:     "https://example.com/purge",
+		},
+	})
+
+	ln, err := s.listen()
+	require.NoError(t, err)
+
+	defer ln.Close()
+	defer s.Shutdown()
+	go s.serve(ln)
+
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:8010/foo", bytes.NewBufferString("Hello"))
+	req.SetBasicAuth("cms-a", "secret")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	select {
+	case record := <-records:
+		assert.Equal(t, hubRecord{"https://example.com/purge/brand-a", "Bearer token-a"}, record)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not published")
+	}
+
+	spooled, _ := ioutil.ReadDir(filepath.Join(dir, "spool"))
+	for _, f := range spooled {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, "spool", f.Name()))
+		assert.NotContains(t, string(b), "token-a")
+	}
+}
+
+func TestListenInvalidTenants(t *testing.T) {
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr:    ":8011",
+			Tenants: "/path/to/missing.json",
+		},
+	})
+
+	_, err := s.listen()
+	assert.EqualError(t, err, "server: load tenants: open /path/to/missing.json: no such file or directory")
+}
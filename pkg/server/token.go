@@ -0,0 +1,46 @@
+package server
+
+import (
+	"github.com/jderusse/http-broadcast/pkg/token"
+)
+
+// initTokens creates the providers of the tokens used to publish in the topic
+// of the hub and of each tenant, and to subscribe to the status topic.
+func (s *Server) initTokens() error {
+	publishToken, err := token.Publisher(s.options, s.options.Hub.Topic)
+	if err != nil {
+		return err
+	}
+
+	s.publisher.SetTokenProvider(publishToken)
+
+	if s.status != nil {
+		topics := []string{}
+		for _, name := range s.statusScopes() {
+			topics = append(topics, s.statusTopic(name))
+		}
+
+		if s.subscribeToken, err = token.Subscriber(s.options, topics...); err != nil {
+			return err
+		}
+	}
+
+	if s.tenants == nil {
+		return nil
+	}
+
+	s.tenantTokens = map[string]token.Provider{}
+
+	for _, t := range s.tenants.Tenants() {
+		switch {
+		case t.PublishToken != "":
+			s.tenantTokens[t.Name] = token.Static(t.PublishToken)
+		case s.options.Hub.JWT.Key != "":
+			if s.tenantTokens[t.Name], err = token.Publisher(s.options, t.Topic); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
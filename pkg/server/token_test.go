@@ -0,0 +1,103 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+func TestHandleMintedTokens(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	file := filepath.Join(dir, "tenants.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{
+		"brand-a": {"users": {"cms-a": "`+string(hash)+`"}},
+		"brand-b": {"users": {"cms-b": "`+string(hash)+`"}, "publish_token": "token-b"}
+	}`), 0600))
+
+	var records []hubRecord
+	var mu sync.Mutex
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+		mu.Lock()
+		records = append(records, hubRecord{form.Get("topic"), strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")})
+		mu.Unlock()
+	}))
+	defer httpServer.Close()
+
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr:    ":8012",
+			Tenants: file,
+		},
+		Hub: config.HubOptions{
+			Endpoints: []*url.URL{parseSafeURL(httpServer.URL)},
+			Topic:     "https://example.com/purge",
+			JWT: config.JWTOptions{
+				Algorithm: config.JWTAlgorithmHS256,
+				Key:       "!ChangeMe!",
+				TTL:       time.Hour,
+			},
+		},
+	})
+
+	ln, err := s.listen()
+	require.NoError(t, err)
+
+	defer ln.Close()
+	defer s.Shutdown()
+	go s.serve(ln)
+
+	for _, user := range []string{"cms-a", "cms-b"} {
+		req, _ := http.NewRequest("PURGE", "http://127.0.0.1:8012/foo", nil)
+		req.SetBasicAuth(user, "secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "https://example.com/purge/brand-a", records[0].topic)
+	assert.Equal(t, "https://example.com/purge/brand-b", records[1].topic)
+	assert.Equal(t, "token-b", records[1].authorization)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(records[0].authorization, claims, func(*jwt.Token) (interface{}, error) { return []byte("!ChangeMe!"), nil })
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"publish": []interface{}{"https://example.com/purge/brand-a"}}, claims["mercure"])
+}
+
+func TestListenInvalidJWTKey(t *testing.T) {
+	s := NewServer(&config.Options{
+		Server: config.ServerOptions{
+			Addr: ":8013",
+		},
+		Hub: config.HubOptions{
+			JWT: config.JWTOptions{
+				Algorithm: config.JWTAlgorithmRS256,
+				Key:       "invalid",
+			},
+		},
+	})
+
+	_, err := s.listen()
+	assert.EqualError(t, err, "server: create tokens: invalid key: Key must be a PEM encoded PKCS1 or PKCS8 key")
+}
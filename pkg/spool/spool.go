@@ -0,0 +1,220 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const fileExt = ".msg"
+
+// rejectedDir is the directory, inside the spool, where rejected messages are
+// moved to
+const rejectedDir = "rejected"
+
+// ErrFull is returned by Push when the spool reached its maximum size.
+var ErrFull = errors.New("spool: full")
+
+// Spool is a bounded FIFO queue of messages persisted on disk.
+// Each message is stored in its own file, named after a sequence number.
+type Spool struct {
+	dir     string
+	maxSize int
+
+	mu      sync.Mutex
+	seq     uint64
+	items   []string
+	changed chan struct{}
+}
+
+// Open opens the spool stored in the given directory, and loads the
+// messages left by a previous process.
+// A maxSize of 0 means the spool is unbounded.
+func Open(dir string, maxSize int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "spool: create directory")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "spool: read directory")
+	}
+
+	s := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		changed: make(chan struct{}),
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, fileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+
+		s.items = append(s.items, name)
+	}
+
+	sort.Strings(s.items)
+
+	return s, nil
+}
+
+// Push appends a message at the end of the queue.
+func (s *Spool) Push(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxSize > 0 && len(s.items) >= s.maxSize {
+		return ErrFull
+	}
+
+	name := fmt.Sprintf("%020d%s", s.seq, fileExt)
+
+	tmp, err := ioutil.TempFile(s.dir, ".tmp")
+	if err != nil {
+		return errors.Wrap(err, "spool: create message")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return errors.Wrap(err, "spool: write message")
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return errors.Wrap(err, "spool: write message")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "spool: write message")
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return errors.Wrap(err, "spool: write message")
+	}
+
+	if err := syncDir(s.dir); err != nil {
+		return errors.Wrap(err, "spool: write message")
+	}
+
+	s.seq++
+	s.items = append(s.items, name)
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	return nil
+}
+
+// Next blocks until a message is available and returns the message at the
+// front of the queue without removing it.
+func (s *Spool) Next(ctx context.Context) ([]byte, error) {
+	for {
+		s.mu.Lock()
+		changed := s.changed
+
+		if len(s.items) > 0 {
+			name := s.items[0]
+			s.mu.Unlock()
+
+			data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+			if err != nil {
+				return nil, errors.Wrap(err, "spool: read message")
+			}
+
+			return data, nil
+		}
+
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Ack removes the message at the front of the queue.
+func (s *Spool) Ack() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.items) == 0 {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, s.items[0])); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "spool: remove message")
+	}
+
+	s.items = s.items[1:]
+
+	return nil
+}
+
+// Reject moves the message at the front of the queue into the `rejected`
+// directory of the spool, for later inspection.
+func (s *Spool) Reject() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.items) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(s.dir, rejectedDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "spool: reject message")
+	}
+
+	if err := os.Rename(filepath.Join(s.dir, s.items[0]), filepath.Join(dir, s.items[0])); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "spool: reject message")
+	}
+
+	s.items = s.items[1:]
+
+	return nil
+}
+
+// Len returns the number of messages in the queue.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// syncDir flushes the entries of the directory to the disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,128 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushAndNext(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push([]byte("foo")))
+	require.NoError(t, s.Push([]byte("bar")))
+	assert.Equal(t, 2, s.Len())
+
+	data, err := s.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+
+	// Next does not remove the message
+	data, err = s.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+
+	require.NoError(t, s.Ack())
+	assert.Equal(t, 1, s.Len())
+
+	data, err = s.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+}
+
+func TestFull(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push([]byte("foo")))
+	assert.Equal(t, ErrFull, s.Push([]byte("bar")))
+}
+
+func TestReopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push([]byte("foo")))
+	require.NoError(t, s.Push([]byte("bar")))
+	require.NoError(t, s.Ack())
+
+	s, err = Open(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+
+	require.NoError(t, s.Push([]byte("baz")))
+
+	data, _ := s.Next(context.Background())
+	assert.Equal(t, "bar", string(data))
+	s.Ack()
+
+	data, _ = s.Next(context.Background())
+	assert.Equal(t, "baz", string(data))
+}
+
+func TestNextWaits(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Push([]byte("foo"))
+	}()
+
+	data, err := s.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+
+	s.Ack()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = s.Next(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestReject(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push([]byte("foo")))
+	require.NoError(t, s.Push([]byte("bar")))
+	require.NoError(t, s.Reject())
+	assert.Equal(t, 1, s.Len())
+
+	data, err := s.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+
+	rejected, err := ioutil.ReadFile(filepath.Join(dir, rejectedDir, fmt.Sprintf("%020d%s", 0, fileExt)))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(rejected))
+
+	// rejected messages are not loaded again
+	s, err = Open(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+}
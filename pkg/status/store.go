@@ -0,0 +1,272 @@
+package status
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+// States of the delivery of a message to an agent
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailure = "failure"
+)
+
+// Report describes the delivery of a message to the known agents.
+type Report struct {
+	ID       string
+	Complete bool
+	Agents   map[string]AgentReport
+}
+
+// AgentReport describes the delivery of a message to a single agent.
+type AgentReport struct {
+	State      string
+	StatusCode int           `json:",omitempty"`
+	Error      string        `json:",omitempty"`
+	Latency    time.Duration `json:",omitempty"`
+	Time       *time.Time    `json:",omitempty"`
+}
+
+// Store aggregates the acknowledgements sent by agents. The number of
+// messages is bounded: the oldest messages are forgotten first.
+type Store struct {
+	maxSize  int
+	agentTTL time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	messages map[string]map[string]dto.Ack
+	order    []string
+	agents   map[string]dto.Heartbeat
+}
+
+// snapshot is the serializable representation of the Store.
+type snapshot struct {
+	Messages map[string]map[string]dto.Ack
+	Order    []string
+	Agents   map[string]dto.Heartbeat
+}
+
+// NewStore allocates and returns a new Store.
+// A maxSize of 0 means the store is unbounded.
+func NewStore(maxSize int, agentTTL time.Duration) *Store {
+	return &Store{
+		maxSize:  maxSize,
+		agentTTL: agentTTL,
+		now:      time.Now,
+		messages: map[string]map[string]dto.Ack{},
+		agents:   map[string]dto.Heartbeat{},
+	}
+}
+
+// Track registers a message published by the server, in order to report it
+// as pending before receiving any acknowledgement.
+func (s *Store) Track(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trackLocked(id)
+}
+
+// Ack records the acknowledgement of a message by an agent.
+func (s *Store) Ack(ack dto.Ack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trackLocked(ack.MessageID)[ack.Agent] = ack
+
+	heartbeat, ok := s.agents[ack.Agent]
+	if !ok {
+		heartbeat = dto.Heartbeat{Agent: ack.Agent}
+	}
+
+	heartbeat.Time = ack.Time
+	s.seenLocked(heartbeat)
+}
+
+// Heartbeat records the presence of an agent.
+func (s *Store) Heartbeat(heartbeat dto.Heartbeat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seenLocked(heartbeat)
+}
+
+// Agents returns the last heartbeat of the live agents, sorted by name.
+func (s *Store) Agents() []dto.Heartbeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agents := []dto.Heartbeat{}
+	for _, heartbeat := range s.liveAgentsLocked() {
+		agents = append(agents, heartbeat)
+	}
+
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Agent < agents[j].Agent
+	})
+
+	return agents
+}
+
+// Get returns the delivery report of the given message. The report lists
+// the agents which acknowledged the message and the live agents which did
+// not yet.
+func (s *Store) Get(id string) (Report, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acks, ok := s.messages[id]
+	if !ok {
+		return Report{}, false
+	}
+
+	report := Report{
+		ID:     id,
+		Agents: map[string]AgentReport{},
+	}
+
+	for agent := range s.liveAgentsLocked() {
+		report.Agents[agent] = AgentReport{State: StatePending}
+	}
+
+	for agent, ack := range acks {
+		t := ack.Time
+		state := StateFailure
+
+		if ack.Success {
+			state = StateSuccess
+		}
+
+		report.Agents[agent] = AgentReport{
+			State:      state,
+			StatusCode: ack.StatusCode,
+			Error:      ack.Error,
+			Latency:    ack.Latency,
+			Time:       &t,
+		}
+	}
+
+	// a message nobody received is not complete
+	report.Complete = len(report.Agents) > 0
+
+	for _, agent := range report.Agents {
+		if agent.State != StateSuccess {
+			report.Complete = false
+		}
+	}
+
+	return report, true
+}
+
+// Load restores the content of the store previously saved in the file.
+func (s *Store) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range snap.Order {
+		acks := s.trackLocked(id)
+		for agent, ack := range snap.Messages[id] {
+			acks[agent] = ack
+		}
+	}
+
+	for _, heartbeat := range snap.Agents {
+		s.seenLocked(heartbeat)
+	}
+
+	return nil
+}
+
+// Save atomically stores the content of the store in the file.
+func (s *Store) Save(path string) error {
+	s.mu.Lock()
+	b, err := json.Marshal(snapshot{
+		Messages: s.messages,
+		Order:    s.order,
+		Agents:   s.agents,
+	})
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".status")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) trackLocked(id string) map[string]dto.Ack {
+	if acks, ok := s.messages[id]; ok {
+		return acks
+	}
+
+	if s.maxSize > 0 && len(s.order) >= s.maxSize {
+		delete(s.messages, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	acks := map[string]dto.Ack{}
+	s.messages[id] = acks
+	s.order = append(s.order, id)
+
+	return acks
+}
+
+func (s *Store) seenLocked(heartbeat dto.Heartbeat) {
+	if heartbeat.Time.After(s.agents[heartbeat.Agent].Time) {
+		s.agents[heartbeat.Agent] = heartbeat
+	}
+}
+
+// liveAgentsLocked returns the agents seen recently, and forgets the others.
+func (s *Store) liveAgentsLocked() map[string]dto.Heartbeat {
+	if s.agentTTL > 0 {
+		deadline := s.now().Add(-s.agentTTL)
+		for agent, heartbeat := range s.agents {
+			if heartbeat.Time.Before(deadline) {
+				delete(s.agents, agent)
+			}
+		}
+	}
+
+	return s.agents
+}
@@ -0,0 +1,126 @@
+package status
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestStoreGetUnknown(t *testing.T) {
+	s := NewStore(10, time.Minute)
+
+	_, ok := s.Get("foo")
+	assert.False(t, ok)
+}
+
+func TestStoreReport(t *testing.T) {
+	now := time.Now()
+	s := NewStore(10, time.Minute)
+
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-1", Time: now})
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-2", Time: now})
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-3", Time: now.Add(-2 * time.Minute)})
+	s.Track("foo")
+
+	report, ok := s.Get("foo")
+	require.True(t, ok)
+	assert.False(t, report.Complete)
+	assert.Equal(t, map[string]AgentReport{
+		"agent-1": {State: StatePending},
+		"agent-2": {State: StatePending},
+	}, report.Agents)
+
+	s.Ack(dto.Ack{MessageID: "foo", Agent: "agent-1", Success: true, StatusCode: 200, Latency: time.Second, Time: now})
+	s.Ack(dto.Ack{MessageID: "foo", Agent: "agent-2", Success: false, StatusCode: 500, Time: now})
+
+	report, ok = s.Get("foo")
+	require.True(t, ok)
+	assert.False(t, report.Complete)
+	assert.Equal(t, StateSuccess, report.Agents["agent-1"].State)
+	assert.Equal(t, time.Second, report.Agents["agent-1"].Latency)
+	assert.Equal(t, StateFailure, report.Agents["agent-2"].State)
+	assert.Equal(t, 500, report.Agents["agent-2"].StatusCode)
+
+	s.Ack(dto.Ack{MessageID: "foo", Agent: "agent-2", Success: true, StatusCode: 200, Time: now})
+
+	report, _ = s.Get("foo")
+	assert.True(t, report.Complete)
+}
+
+func TestStoreReportWithoutAgents(t *testing.T) {
+	s := NewStore(10, time.Minute)
+
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-1", Time: time.Now().Add(-2 * time.Minute)})
+	s.Track("foo")
+
+	report, ok := s.Get("foo")
+	require.True(t, ok)
+	assert.False(t, report.Complete)
+	assert.Empty(t, report.Agents)
+}
+
+func TestStoreMaxSize(t *testing.T) {
+	s := NewStore(2, time.Minute)
+
+	s.Track("foo")
+	s.Track("bar")
+	s.Ack(dto.Ack{MessageID: "baz", Agent: "agent-1", Time: time.Now()})
+
+	_, ok := s.Get("foo")
+	assert.False(t, ok)
+	_, ok = s.Get("bar")
+	assert.True(t, ok)
+	_, ok = s.Get("baz")
+	assert.True(t, ok)
+}
+
+func TestStoreAgents(t *testing.T) {
+	now := time.Now()
+	s := NewStore(10, time.Minute)
+
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-2", Version: "1.0.0", Pending: 3, Lag: time.Second, Time: now})
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-2", Version: "0.9.0", Time: now.Add(-time.Second)})
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-3", Time: now.Add(-2 * time.Minute)})
+	s.Ack(dto.Ack{MessageID: "foo", Agent: "agent-1", Time: now})
+
+	agents := s.Agents()
+	require.Len(t, agents, 2)
+	assert.Equal(t, "agent-1", agents[0].Agent)
+	assert.Equal(t, dto.Heartbeat{Agent: "agent-2", Version: "1.0.0", Pending: 3, Lag: time.Second, Time: now}, agents[1])
+
+	s.Ack(dto.Ack{MessageID: "foo", Agent: "agent-2", Time: now.Add(time.Second)})
+
+	agents = s.Agents()
+	assert.Equal(t, "1.0.0", agents[1].Version)
+	assert.Equal(t, now.Add(time.Second), agents[1].Time)
+}
+
+func TestStoreSaveLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "status.json")
+	now := time.Now()
+
+	s := NewStore(10, time.Minute)
+	require.NoError(t, s.Load(path))
+
+	s.Heartbeat(dto.Heartbeat{Agent: "agent-1", Time: now})
+	s.Ack(dto.Ack{MessageID: "foo", Agent: "agent-2", Success: true, Time: now})
+	require.NoError(t, s.Save(path))
+
+	s = NewStore(10, time.Minute)
+	require.NoError(t, s.Load(path))
+
+	report, ok := s.Get("foo")
+	require.True(t, ok)
+	assert.Equal(t, StatePending, report.Agents["agent-1"].State)
+	assert.Equal(t, StateSuccess, report.Agents["agent-2"].State)
+}
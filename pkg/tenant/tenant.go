@@ -0,0 +1,154 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Tenant is an isolated group of publishers and agents sharing a topic.
+type Tenant struct {
+	Name string `json:"-"`
+	// Users maps the users of the tenant to the bcrypt hashes of their
+	// passwords
+	Users map[string]string `json:"users"`
+	// Topic overrides the default topic of the tenant
+	Topic string `json:"topic"`
+	// PublishToken is the JWT used to publish on the topic of the tenant,
+	// defaults to the publish token of the hub
+	PublishToken string `json:"publish_token"`
+}
+
+// dummyHash is compared to the passwords of unknown users, for the time taken
+// to reject them to not reveal which users exist
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// Registry stores the tenants.
+type Registry struct {
+	tenants map[string]*Tenant
+	users   map[string]*Tenant
+	topics  map[string]*Tenant
+}
+
+type contextKey struct{}
+
+// Topic returns the default topic of a tenant: the given base topic suffixed
+// with the name of the tenant.
+func Topic(base string, name string) string {
+	return strings.TrimSuffix(base, "/") + "/" + name
+}
+
+// Load returns the registry of the tenants defined in the given JSON file.
+// Tenants without topic use the default topic derived from baseTopic.
+func Load(file string, baseTopic string) (*Registry, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants map[string]*Tenant
+	if err := json.Unmarshal(b, &tenants); err != nil {
+		return nil, err
+	}
+
+	return New(tenants, baseTopic)
+}
+
+// New returns a registry of the given tenants. Users and topics must be unique
+// among tenants.
+func New(tenants map[string]*Tenant, baseTopic string) (*Registry, error) {
+	r := &Registry{
+		tenants: map[string]*Tenant{},
+		users:   map[string]*Tenant{},
+		topics:  map[string]*Tenant{},
+	}
+
+	for name, t := range tenants {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf(`invalid tenant name "%s"`, name)
+		}
+
+		t.Name = name
+		if t.Topic == "" {
+			t.Topic = Topic(baseTopic, name)
+		}
+
+		if other, ok := r.topics[t.Topic]; ok {
+			return nil, fmt.Errorf(`topic "%s" shared by tenants "%s" and "%s"`, t.Topic, other.Name, name)
+		}
+
+		r.topics[t.Topic] = t
+
+		for user := range t.Users {
+			if other, ok := r.users[user]; ok {
+				return nil, fmt.Errorf(`user "%s" shared by tenants "%s" and "%s"`, user, other.Name, name)
+			}
+
+			r.users[user] = t
+		}
+
+		r.tenants[name] = t
+	}
+
+	return r, nil
+}
+
+// Authenticate returns the tenant of the user when the password is valid.
+func (r *Registry) Authenticate(user string, password string) (*Tenant, bool) {
+	t, ok := r.users[user]
+	if !ok {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		})
+
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+
+		return nil, false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(t.Users[user]), []byte(password)); err != nil {
+		return nil, false
+	}
+
+	return t, true
+}
+
+// Tenants returns the tenants sorted by name.
+func (r *Registry) Tenants() []*Tenant {
+	tenants := make([]*Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		tenants = append(tenants, t)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+
+	return tenants
+}
+
+// ByTopic returns the tenant owning the topic.
+func (r *Registry) ByTopic(topic string) (*Tenant, bool) {
+	t, ok := r.topics[topic]
+
+	return t, ok
+}
+
+// NewContext returns a copy of the context holding the tenant.
+func NewContext(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant stored in the context, if any.
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+
+	return t, ok
+}
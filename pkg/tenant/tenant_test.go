@@ -0,0 +1,87 @@
+package tenant
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoad(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	f, _ := ioutil.TempFile("", "http-broadcast")
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{
+		"brand-a": {"users": {"cms-a": "` + string(hash) + `"}, "publish_token": "token-a"},
+		"brand-b": {"users": {"cms-b": "` + string(hash) + `"}, "topic": "https://example.com/b"}
+	}`)
+	f.Close()
+
+	r, err := Load(f.Name(), "https://example.com/purge/")
+	require.NoError(t, err)
+
+	ta, ok := r.Authenticate("cms-a", "secret")
+	require.True(t, ok)
+	assert.Equal(t, "brand-a", ta.Name)
+	assert.Equal(t, "https://example.com/purge/brand-a", ta.Topic)
+	assert.Equal(t, "token-a", ta.PublishToken)
+
+	tb, ok := r.ByTopic("https://example.com/b")
+	require.True(t, ok)
+	assert.Equal(t, "brand-b", tb.Name)
+
+	_, ok = r.ByTopic("https://example.com/purge")
+	assert.False(t, ok)
+
+	_, ok = r.Authenticate("cms-a", "invalid")
+	assert.False(t, ok)
+
+	_, ok = r.Authenticate("cms-c", "secret")
+	assert.False(t, ok)
+
+	_, ok = r.Authenticate("", "")
+	assert.False(t, ok)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load("/path/to/missing.json", "")
+	assert.Error(t, err)
+
+	_, err = New(map[string]*Tenant{"a/b": {}}, "topic")
+	assert.EqualError(t, err, `invalid tenant name "a/b"`)
+
+	_, err = New(map[string]*Tenant{
+		"a": {Topic: "topic"},
+		"b": {Topic: "topic"},
+	}, "topic")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `topic "topic" shared by tenants`)
+
+	_, err = New(map[string]*Tenant{
+		"a": {Users: map[string]string{"cms": ""}},
+		"b": {Users: map[string]string{"cms": ""}},
+	}, "topic")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `user "cms" shared by tenants`)
+}
+
+func TestTopic(t *testing.T) {
+	assert.Equal(t, "https://example.com/purge/brand-a", Topic("https://example.com/purge", "brand-a"))
+	assert.Equal(t, "https://example.com/purge/brand-a", Topic("https://example.com/purge/", "brand-a"))
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	tenant := &Tenant{Name: "brand-a"}
+	actual, ok := FromContext(NewContext(context.Background(), tenant))
+	require.True(t, ok)
+	assert.Same(t, tenant, actual)
+}
@@ -0,0 +1,218 @@
+package token
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/secret"
+)
+
+// renewRatio is the part of the lifetime of a minted token after which it is
+// renewed
+const renewRatio = 2.0 / 3
+
+// Provider provides the tokens used to authenticate with the hub.
+type Provider interface {
+	// Token returns a token and the time it should be renewed at. The time
+	// is zero when the token never expires.
+	Token() (string, time.Time, error)
+}
+
+// Static is a token which never changes.
+type Static string
+
+// Token returns the static token.
+func (s Static) Token() (string, time.Time, error) {
+	return string(s), time.Time{}, nil
+}
+
+// Secret is a token read from the secret store on each call, following the
+// rotations of the secret.
+type Secret struct {
+	Store *secret.Store
+	Name  string
+}
+
+// Token returns the current value of the secret.
+func (s Secret) Token() (string, time.Time, error) {
+	token, _ := s.Store.Get(s.Name)
+
+	return token, time.Time{}, nil
+}
+
+// Claims lists the topics and targets a token is allowed to publish and to
+// subscribe to.
+type Claims struct {
+	Publish   []string `json:"publish,omitempty"`
+	Subscribe []string `json:"subscribe,omitempty"`
+}
+
+type mercureClaims struct {
+	jwt.RegisteredClaims
+	Mercure Claims `json:"mercure"`
+}
+
+// Minter mints short-lived Mercure JWTs, and renews them before they expire.
+type Minter struct {
+	method jwt.SigningMethod
+	rawKey func() string
+	ttl    time.Duration
+	claims Claims
+	now    func() time.Time
+
+	mu      sync.Mutex
+	raw     string
+	key     interface{}
+	token   string
+	renewAt time.Time
+}
+
+// NewMinter returns a minter signing the tokens with the key of the options.
+// HS256 keys are shared secrets, RS256 and ES256 keys are PEM encoded private
+// keys.
+func NewMinter(options config.JWTOptions, claims Claims) (*Minter, error) {
+	return NewRotatingMinter(options, claims, func() string { return options.Key })
+}
+
+// NewRotatingMinter returns a minter signing the tokens with the key returned
+// by the key function. A new token is minted as soon as the key changes.
+func NewRotatingMinter(options config.JWTOptions, claims Claims, key func() string) (*Minter, error) {
+	m := &Minter{
+		rawKey: key,
+		ttl:    options.TTL,
+		claims: claims,
+		now:    time.Now,
+	}
+
+	switch options.Algorithm {
+	case config.JWTAlgorithmHS256, "":
+		m.method = jwt.SigningMethodHS256
+	case config.JWTAlgorithmRS256:
+		m.method = jwt.SigningMethodRS256
+	case config.JWTAlgorithmES256:
+		m.method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf(`unsupported algorithm "%s"`, options.Algorithm)
+	}
+
+	if err := m.loadKey(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// loadKey parses the key when it changed since the last call, and discards the
+// token signed with the previous key.
+func (m *Minter) loadKey() error {
+	raw := m.rawKey()
+	if m.key != nil && raw == m.raw {
+		return nil
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+
+	switch m.method {
+	case jwt.SigningMethodRS256:
+		key, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(raw))
+	case jwt.SigningMethodES256:
+		key, err = jwt.ParseECPrivateKeyFromPEM([]byte(raw))
+	default:
+		key = []byte(raw)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.raw, m.key, m.token = raw, key, ""
+
+	return nil
+}
+
+// Token returns the current token, minting a new one when the current token
+// should be renewed or when the key changed.
+func (m *Minter) Token() (string, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.loadKey(); err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := m.now()
+	if m.token != "" && now.Before(m.renewAt) {
+		return m.token, m.renewAt, nil
+	}
+
+	token, err := jwt.NewWithClaims(m.method, mercureClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+		},
+		Mercure: m.claims,
+	}).SignedString(m.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	m.token = token
+	m.renewAt = now.Add(time.Duration(float64(m.ttl) * renewRatio))
+
+	return m.token, m.renewAt, nil
+}
+
+// Publisher returns the provider of the tokens allowed to publish in the
+// given topics: a minter when a signing key is configured, the publish token
+// otherwise.
+func Publisher(options *config.Options, topics ...string) (Provider, error) {
+	return newProvider(options, config.SecretHubPublishToken, options.Hub.PublishToken, Claims{Publish: withTarget(topics, options.Hub.Target)})
+}
+
+// Subscriber returns the provider of the tokens allowed to subscribe to the
+// given topics: a minter when a signing key is configured, the subscribe
+// token otherwise.
+func Subscriber(options *config.Options, topics ...string) (Provider, error) {
+	return newProvider(options, config.SecretHubSubscribeToken, options.Hub.SubscribeToken, Claims{Subscribe: withTarget(topics, options.Hub.Target)})
+}
+
+// newProvider returns a provider following the rotations of the secret when
+// the token, or the signing key, is tracked by the secret store.
+func newProvider(options *config.Options, name string, static string, claims Claims) (Provider, error) {
+	store := options.Secrets.Store
+
+	if options.Hub.JWT.Key == "" {
+		if _, ok := store.Get(name); ok {
+			return Secret{Store: store, Name: name}, nil
+		}
+
+		return Static(static), nil
+	}
+
+	if _, ok := store.Get(config.SecretHubJWTKey); ok {
+		return NewRotatingMinter(options.Hub.JWT, claims, func() string {
+			key, _ := store.Get(config.SecretHubJWTKey)
+
+			return key
+		})
+	}
+
+	return NewMinter(options.Hub.JWT, claims)
+}
+
+// withTarget appends the target of the hub to the topics: hubs implementing
+// the older versions of the protocol authorize targets instead of topics.
+func withTarget(topics []string, target string) []string {
+	if target == "" {
+		return topics
+	}
+
+	return append(append([]string{}, topics...), target)
+}
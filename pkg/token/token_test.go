@@ -0,0 +1,212 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/secret"
+)
+
+// source is a secret source returning the current value of a variable.
+type source struct {
+	value *string
+}
+
+func (s source) Read(context.Context) (string, error) {
+	return *s.value, nil
+}
+
+func parse(t *testing.T, token string, key interface{}) *mercureClaims {
+	claims := &mercureClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return key, nil })
+	require.NoError(t, err)
+
+	return claims
+}
+
+func TestStatic(t *testing.T) {
+	token, renewAt, err := Static("token").Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.True(t, renewAt.IsZero())
+}
+
+func TestMinterHS256(t *testing.T) {
+	m, err := NewMinter(config.JWTOptions{Algorithm: config.JWTAlgorithmHS256, Key: "secret", TTL: time.Hour}, Claims{Publish: []string{"topic"}})
+	require.NoError(t, err)
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	token, renewAt, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(40*time.Minute), renewAt)
+
+	claims := parse(t, token, []byte("secret"))
+	assert.Equal(t, Claims{Publish: []string{"topic"}}, claims.Mercure)
+	assert.Equal(t, now.Add(time.Hour).Unix(), claims.ExpiresAt.Unix())
+
+	// the token is reused until it should be renewed
+	now = now.Add(39 * time.Minute)
+	cached, _, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, token, cached)
+
+	now = now.Add(time.Minute)
+	renewed, renewAt, err := m.Token()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, renewed)
+	assert.Equal(t, now.Add(40*time.Minute), renewAt)
+}
+
+func TestMinterRS256(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	m, err := NewMinter(config.JWTOptions{Algorithm: config.JWTAlgorithmRS256, Key: string(pemKey), TTL: time.Hour}, Claims{Subscribe: []string{"topic"}})
+	require.NoError(t, err)
+
+	token, _, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, Claims{Subscribe: []string{"topic"}}, parse(t, token, &key.PublicKey).Mercure)
+}
+
+func TestMinterES256(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	m, err := NewMinter(config.JWTOptions{Algorithm: config.JWTAlgorithmES256, Key: string(pemKey), TTL: time.Hour}, Claims{Subscribe: []string{"topic"}})
+	require.NoError(t, err)
+
+	token, _, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, Claims{Subscribe: []string{"topic"}}, parse(t, token, &key.PublicKey).Mercure)
+}
+
+func TestMinterInvalid(t *testing.T) {
+	_, err := NewMinter(config.JWTOptions{Algorithm: "none", Key: "secret"}, Claims{})
+	assert.EqualError(t, err, `unsupported algorithm "none"`)
+
+	_, err = NewMinter(config.JWTOptions{Algorithm: config.JWTAlgorithmRS256, Key: "secret"}, Claims{})
+	assert.Error(t, err)
+
+	_, err = NewMinter(config.JWTOptions{Algorithm: config.JWTAlgorithmES256, Key: "secret"}, Claims{})
+	assert.Error(t, err)
+}
+
+func TestMinterRotation(t *testing.T) {
+	key := "secret"
+	m, err := NewRotatingMinter(config.JWTOptions{TTL: time.Hour}, Claims{Publish: []string{"topic"}}, func() string { return key })
+	require.NoError(t, err)
+
+	token, _, err := m.Token()
+	require.NoError(t, err)
+	parse(t, token, []byte("secret"))
+
+	cached, _, err := m.Token()
+	require.NoError(t, err)
+	assert.Equal(t, token, cached)
+
+	// a new token is minted as soon as the key changes
+	key = "rotated"
+	rotated, _, err := m.Token()
+	require.NoError(t, err)
+	parse(t, rotated, []byte("rotated"))
+}
+
+func TestMinterRotationInvalidKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+
+	m, err := NewRotatingMinter(config.JWTOptions{Algorithm: config.JWTAlgorithmES256, TTL: time.Hour}, Claims{}, func() string { return pemKey })
+	require.NoError(t, err)
+
+	pemKey = "invalid"
+	_, _, err = m.Token()
+	assert.Error(t, err)
+}
+
+func TestPublisherSecret(t *testing.T) {
+	value := "publish"
+	store := secret.NewStore()
+	_, err := store.Add(context.Background(), config.SecretHubPublishToken, source{&value})
+	require.NoError(t, err)
+
+	options := &config.Options{Hub: config.HubOptions{PublishToken: value}, Secrets: config.SecretsOptions{Store: store}}
+
+	p, err := Publisher(options, "topic")
+	require.NoError(t, err)
+
+	// the provider follows the rotations of the secret
+	value = "rotated"
+	store.Refresh(context.Background())
+
+	token, renewAt, err := p.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", token)
+	assert.True(t, renewAt.IsZero())
+
+	// the subscribe token is not tracked
+	s, err := Subscriber(options, "topic")
+	require.NoError(t, err)
+	assert.Equal(t, Static(""), s)
+}
+
+func TestPublisherSecretKey(t *testing.T) {
+	value := "secret"
+	store := secret.NewStore()
+	_, err := store.Add(context.Background(), config.SecretHubJWTKey, source{&value})
+	require.NoError(t, err)
+
+	options := &config.Options{Hub: config.HubOptions{JWT: config.JWTOptions{Key: value, TTL: time.Hour}}, Secrets: config.SecretsOptions{Store: store}}
+
+	p, err := Publisher(options, "topic")
+	require.NoError(t, err)
+
+	token, _, _ := p.Token()
+	parse(t, token, []byte("secret"))
+
+	value = "rotated"
+	store.Refresh(context.Background())
+
+	token, _, _ = p.Token()
+	parse(t, token, []byte("rotated"))
+}
+
+func TestPublisherSubscriber(t *testing.T) {
+	options := &config.Options{Hub: config.HubOptions{PublishToken: "publish", SubscribeToken: "subscribe", Target: "target"}}
+
+	p, err := Publisher(options, "topic")
+	require.NoError(t, err)
+	assert.Equal(t, Static("publish"), p)
+
+	s, err := Subscriber(options, "topic")
+	require.NoError(t, err)
+	assert.Equal(t, Static("subscribe"), s)
+
+	options.Hub.JWT = config.JWTOptions{Key: "secret", TTL: time.Hour}
+
+	p, err = Publisher(options, "topic", "status")
+	require.NoError(t, err)
+	token, _, _ := p.Token()
+	assert.Equal(t, Claims{Publish: []string{"topic", "status", "target"}}, parse(t, token, []byte("secret")).Mercure)
+
+	s, err = Subscriber(options, "topic")
+	require.NoError(t, err)
+	token, _, _ = s.Token()
+	assert.Equal(t, Claims{Subscribe: []string{"topic", "target"}}, parse(t, token, []byte("secret")).Mercure)
+}
@@ -0,0 +1,119 @@
+// Package tracing configures the distributed tracing of the requests
+// broadcasted from the Server to the Agents.
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+	"github.com/jderusse/http-broadcast/pkg/version"
+)
+
+const instrumentationName = "github.com/jderusse/http-broadcast"
+
+// Tracer returns the tracer used to instrument the broadcaster.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName, trace.WithInstrumentationVersion(version.Version))
+}
+
+// Propagator returns the propagator used to carry the trace context.
+func Propagator() propagation.TextMapPropagator {
+	return otel.GetTextMapPropagator()
+}
+
+// Setup registers the global tracer provider and W3C trace context
+// propagator. The returned function flushes and stops the exporter.
+func Setup(options config.TracingOptions) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "tracing: create exporter")
+	}
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(options.ServiceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "tracing: create resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(options config.TracingOptions) (sdktrace.SpanExporter, error) {
+	switch options.Exporter {
+	case config.TracingExporterOTLP:
+		// the endpoint is configured with the standard OTEL_EXPORTER_OTLP_* env vars
+		return otlptracehttp.New(context.Background())
+	case config.TracingExporterStdout:
+		var w io.Writer = os.Stdout
+
+		if options.File != "" {
+			f, err := os.OpenFile(options.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				return nil, err
+			}
+
+			w = f
+		}
+
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	}
+
+	return nil, nil
+}
+
+// Inject returns the trace context of ctx serialized into a map, or nil
+// when ctx does not hold any span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	Propagator().Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	return carrier
+}
+
+// Extract returns a copy of ctx holding the trace context serialized by
+// Inject.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return Propagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// TraceID returns the ID of the trace held by ctx, or an empty string.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+
+	return sc.TraceID().String()
+}
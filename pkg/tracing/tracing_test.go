@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/jderusse/http-broadcast/pkg/config"
+)
+
+func TestSetupNone(t *testing.T) {
+	shutdown, err := Setup(config.TracingOptions{Exporter: config.TracingExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetupStdout(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "http-broadcast")
+	defer os.RemoveAll(dir)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	file := filepath.Join(dir, "traces.json")
+	shutdown, err := Setup(config.TracingOptions{
+		Exporter:    config.TracingExporterStdout,
+		File:        file,
+		ServiceName: "my-service",
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "my-span")
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"Name":"my-span"`)
+	assert.Contains(t, string(b), `"my-service"`)
+}
+
+func TestInjectExtract(t *testing.T) {
+	_, err := Setup(config.TracingOptions{Exporter: config.TracingExporterNone})
+	require.NoError(t, err)
+
+	assert.Nil(t, Inject(context.Background()))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	carrier := Inject(ctx)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", carrier["traceparent"])
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(Extract(context.Background(), carrier)))
+	assert.Equal(t, "", TraceID(context.Background()))
+}
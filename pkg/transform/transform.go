@@ -0,0 +1,364 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+var funcs = template.FuncMap{
+	"lower":        strings.ToLower,
+	"upper":        strings.ToUpper,
+	"clean":        path.Clean,
+	"join":         func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	"trimPrefix":   func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":   func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":      func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+	"regexReplace": regexReplace,
+}
+
+// RejectError is returned when a rule rejects a request.
+type RejectError struct {
+	Status  int
+	Message string
+}
+
+func (e *RejectError) Error() string {
+	return e.Message
+}
+
+// Rule describes a transformation applied to the requests it matches. The
+// actions are applied in order: reject, split, set and delete.
+type Rule struct {
+	Match Match `json:"match"`
+	// Reject rejects the request with the given status and message
+	Reject *Reject `json:"reject"`
+	// Split splits the path on the given separator, and broadcasts a request
+	// for each part
+	Split string `json:"split"`
+	// Set overrides the fields of the request with Go templates
+	Set Set `json:"set"`
+	// Delete removes the given headers
+	Delete []string `json:"delete"`
+}
+
+// Match restricts the requests a rule applies to. Host, path and headers are
+// regular expressions. An empty Match matches every request.
+type Match struct {
+	Methods []string          `json:"methods"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+// Reject describes the response sent to the rejected requests.
+type Reject struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// Set stores the templates of the fields of a request. Headers set to an
+// empty value are removed.
+type Set struct {
+	Method  string            `json:"method"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+// Pipeline applies a list of rules to the requests.
+type Pipeline struct {
+	rules []*rule
+}
+
+type rule struct {
+	Rule
+
+	host    *regexp.Regexp
+	path    *regexp.Regexp
+	headers map[string]*regexp.Regexp
+
+	method     *template.Template
+	setHost    *template.Template
+	setPath    *template.Template
+	setHeaders map[string]*template.Template
+}
+
+// Load returns the pipeline of the rules defined in the given JSON file.
+func Load(file string) (*Pipeline, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+
+	return New(rules)
+}
+
+// New compiles the rules and returns a pipeline applying them.
+func New(rules []Rule) (*Pipeline, error) {
+	p := &Pipeline{}
+
+	for i, r := range rules {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i)
+		}
+
+		p.rules = append(p.rules, compiled)
+	}
+
+	return p, nil
+}
+
+func compile(r Rule) (*rule, error) {
+	var err error
+
+	c := &rule{Rule: r, headers: map[string]*regexp.Regexp{}, setHeaders: map[string]*template.Template{}}
+
+	if c.host, err = compileRegexp(r.Match.Host); err != nil {
+		return nil, err
+	}
+
+	if c.path, err = compileRegexp(r.Match.Path); err != nil {
+		return nil, err
+	}
+
+	for name, pattern := range r.Match.Headers {
+		if c.headers[name], err = compileRegexp(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.method, err = compileTemplate("method", r.Set.Method); err != nil {
+		return nil, err
+	}
+
+	if c.setHost, err = compileTemplate("host", r.Set.Host); err != nil {
+		return nil, err
+	}
+
+	if c.setPath, err = compileTemplate("path", r.Set.Path); err != nil {
+		return nil, err
+	}
+
+	for name, text := range r.Set.Headers {
+		if c.setHeaders[name], err = compileTemplate("headers."+name, text); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Reject != nil {
+		reject := *r.Reject
+		if reject.Status == 0 {
+			reject.Status = http.StatusBadRequest
+		}
+
+		c.Reject = &reject
+	}
+
+	return c, nil
+}
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(pattern)
+}
+
+func compileTemplate(name string, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+}
+
+// Apply applies the rules to the request and returns the requests to
+// broadcast. It returns a *RejectError when a rule rejects the request.
+func (p *Pipeline) Apply(request *dto.Request) ([]*dto.Request, error) {
+	requests := []*dto.Request{request}
+
+	for _, r := range p.rules {
+		var next []*dto.Request
+
+		for _, request := range requests {
+			if !r.matches(request) {
+				next = append(next, request)
+
+				continue
+			}
+
+			applied, err := r.apply(request)
+			if err != nil {
+				return nil, err
+			}
+
+			next = append(next, applied...)
+		}
+
+		requests = next
+	}
+
+	return requests, nil
+}
+
+func (r *rule) matches(request *dto.Request) bool {
+	if len(r.Match.Methods) > 0 && !containsFold(r.Match.Methods, request.Method) {
+		return false
+	}
+
+	if r.host != nil && !r.host.MatchString(request.Host) {
+		return false
+	}
+
+	if r.path != nil && !r.path.MatchString(request.Path) {
+		return false
+	}
+
+	for name, re := range r.headers {
+		if !re.MatchString(request.Header.Get(name)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *rule) apply(request *dto.Request) ([]*dto.Request, error) {
+	if r.Reject != nil {
+		return nil, &RejectError{Status: r.Reject.Status, Message: r.Reject.Message}
+	}
+
+	requests := []*dto.Request{request}
+	if r.Split != "" {
+		requests = split(request, r.Split)
+	}
+
+	for _, request := range requests {
+		if err := r.set(request); err != nil {
+			return nil, err
+		}
+
+		for _, name := range r.Delete {
+			request.Header.Del(name)
+		}
+	}
+
+	return requests, nil
+}
+
+func (r *rule) set(request *dto.Request) error {
+	// templates are executed with the request before any change
+	data := *request
+	data.Header = request.Header.Clone()
+
+	execute := func(t *template.Template, field *string) error {
+		if t == nil {
+			return nil
+		}
+
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return err
+		}
+
+		*field = buf.String()
+
+		return nil
+	}
+
+	if err := execute(r.method, &request.Method); err != nil {
+		return err
+	}
+
+	if err := execute(r.setHost, &request.Host); err != nil {
+		return err
+	}
+
+	if err := execute(r.setPath, &request.Path); err != nil {
+		return err
+	}
+
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+
+	for name, t := range r.setHeaders {
+		var value string
+		if err := execute(t, &value); err != nil {
+			return err
+		}
+
+		if value == "" {
+			request.Header.Del(name)
+		} else {
+			request.Header.Set(name, value)
+		}
+	}
+
+	return nil
+}
+
+// split returns a copy of the request for each part of its path. The first
+// copy keeps the ID of the request.
+func split(request *dto.Request, sep string) []*dto.Request {
+	var requests []*dto.Request
+
+	for _, part := range strings.Split(request.Path, sep) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r := *request
+		r.Path = part
+		r.Header = request.Header.Clone()
+
+		if len(requests) > 0 {
+			r.ID = dto.NewID()
+		}
+
+		requests = append(requests, &r)
+	}
+
+	if len(requests) == 0 {
+		return []*dto.Request{request}
+	}
+
+	return requests
+}
+
+func containsFold(list []string, s string) bool {
+	for _, elem := range list {
+		if strings.EqualFold(elem, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func regexReplace(pattern string, repl string, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return re.ReplaceAllString(s, repl), nil
+}
@@ -0,0 +1,156 @@
+package transform
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jderusse/http-broadcast/pkg/dto"
+)
+
+func TestLoad(t *testing.T) {
+	f, _ := ioutil.TempFile("", "http-broadcast")
+	defer os.Remove(f.Name())
+
+	f.WriteString(`[{"match": {"methods": ["PURGE"]}, "set": {"path": "{{ .Path | clean }}"}}]`)
+	f.Close()
+
+	p, err := Load(f.Name())
+	require.NoError(t, err)
+
+	requests, err := p.Apply(&dto.Request{Method: "PURGE", Path: "/foo/../bar"})
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/bar", requests[0].Path)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load("/path/to/missing.json")
+	assert.Error(t, err)
+
+	_, err = New([]Rule{{Match: Match{Path: "("}}})
+	assert.EqualError(t, err, "rule 0: error parsing regexp: missing closing ): `(`")
+
+	_, err = New([]Rule{{Set: Set{Host: "{{ .Host "}}})
+	assert.Error(t, err)
+}
+
+func TestApplyMatch(t *testing.T) {
+	p, err := New([]Rule{
+		{
+			Match: Match{
+				Methods: []string{"purge"},
+				Host:    `^example\.com$`,
+				Path:    "^/foo",
+				Headers: map[string]string{"X-Tenant": "^acme$"},
+			},
+			Set: Set{Headers: map[string]string{"X-Matched": "1"}},
+		},
+	})
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		request dto.Request
+		matched bool
+	}{
+		"match":        {dto.Request{Method: "PURGE", Host: "example.com", Path: "/foo/bar", Header: http.Header{"X-Tenant": {"acme"}}}, true},
+		"other method": {dto.Request{Method: "BAN", Host: "example.com", Path: "/foo/bar", Header: http.Header{"X-Tenant": {"acme"}}}, false},
+		"other host":   {dto.Request{Method: "PURGE", Host: "example.org", Path: "/foo/bar", Header: http.Header{"X-Tenant": {"acme"}}}, false},
+		"other path":   {dto.Request{Method: "PURGE", Host: "example.com", Path: "/bar", Header: http.Header{"X-Tenant": {"acme"}}}, false},
+		"no header":    {dto.Request{Method: "PURGE", Host: "example.com", Path: "/foo/bar", Header: http.Header{}}, false},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			request := c.request
+			requests, err := p.Apply(&request)
+			require.NoError(t, err)
+			require.Len(t, requests, 1)
+			assert.Equal(t, c.matched, requests[0].Header.Get("X-Matched") == "1")
+		})
+	}
+}
+
+func TestApplyReject(t *testing.T) {
+	p, err := New([]Rule{
+		{Match: Match{Methods: []string{"GET"}}, Reject: &Reject{Message: "method not allowed"}},
+	})
+	require.NoError(t, err)
+
+	_, err = p.Apply(&dto.Request{Method: "GET", Path: "/"})
+	require.Error(t, err)
+	assert.Equal(t, &RejectError{Status: http.StatusBadRequest, Message: "method not allowed"}, err)
+
+	requests, err := p.Apply(&dto.Request{Method: "PURGE", Path: "/"})
+	require.NoError(t, err)
+	assert.Len(t, requests, 1)
+}
+
+func TestApplySplit(t *testing.T) {
+	p, err := New([]Rule{{Split: ","}})
+	require.NoError(t, err)
+
+	requests, err := p.Apply(&dto.Request{ID: "foo", Method: "PURGE", Path: "/a, /b,,/c", Header: http.Header{"X-Foo": {"bar"}}})
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+
+	assert.Equal(t, "foo", requests[0].ID)
+	assert.NotEqual(t, "foo", requests[1].ID)
+	assert.NotEqual(t, requests[1].ID, requests[2].ID)
+
+	for i, path := range []string{"/a", "/b", "/c"} {
+		assert.Equal(t, path, requests[i].Path)
+		assert.Equal(t, "PURGE", requests[i].Method)
+		assert.Equal(t, "bar", requests[i].Header.Get("X-Foo"))
+	}
+
+	requests[0].Header.Set("X-Foo", "baz")
+	assert.Equal(t, "bar", requests[1].Header.Get("X-Foo"))
+}
+
+func TestApplySet(t *testing.T) {
+	p, err := New([]Rule{
+		{
+			Set: Set{
+				Method: "{{ .Method | upper }}",
+				Host:   "{{ .Host | lower | trimSuffix \".\" }}",
+				Path:   "{{ .Path | regexReplace \"/+\" \"/\" | trimPrefix \"/api\" }}",
+				Headers: map[string]string{
+					"X-Tenant": "{{ .Header.Get \"X-Brand\" | lower }}",
+					"X-Brand":  "",
+				},
+			},
+			Delete: []string{"Cookie"},
+		},
+	})
+	require.NoError(t, err)
+
+	requests, err := p.Apply(&dto.Request{
+		Method: "purge",
+		Host:   "Example.COM.",
+		Path:   "/api//foo",
+		Header: http.Header{"X-Brand": {"ACME"}, "Cookie": {"foo=bar"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+
+	assert.Equal(t, "PURGE", requests[0].Method)
+	assert.Equal(t, "example.com", requests[0].Host)
+	assert.Equal(t, "/foo", requests[0].Path)
+	assert.Equal(t, http.Header{"X-Tenant": {"acme"}}, requests[0].Header)
+}
+
+func TestApplyChain(t *testing.T) {
+	p, err := New([]Rule{
+		{Split: ","},
+		{Match: Match{Path: "^/private"}, Reject: &Reject{Status: http.StatusForbidden, Message: "private path"}},
+	})
+	require.NoError(t, err)
+
+	_, err = p.Apply(&dto.Request{Method: "PURGE", Path: "/a,/private/b"})
+	assert.Equal(t, &RejectError{Status: http.StatusForbidden, Message: "private path"}, err)
+}
@@ -0,0 +1,6 @@
+// Package version holds the version of the http-broadcast binary.
+package version
+
+// Version is the version of the binary, defined at build time with
+// -ldflags "-X github.com/jderusse/http-broadcast/pkg/version.Version=x.y.z"
+var Version = "dev"